@@ -3,45 +3,113 @@ package main
 import (
 	"context"
 	"flag"
+	"github.com/quantum0cat/simple-http-mux/internal/cache"
+	"github.com/quantum0cat/simple-http-mux/internal/config"
+	"github.com/quantum0cat/simple-http-mux/internal/http_fetcher"
 	"github.com/quantum0cat/simple-http-mux/internal/http_mux"
+	"github.com/quantum0cat/simple-http-mux/internal/transport"
 	"github.com/quantum0cat/simple-http-mux/pkg/logging"
+	"io"
 	"log"
-	"math"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 )
 
-const defaultPort = 10000
-const defaultMaxConns = 100
-
 func main() {
-	logging.Init()
-	//better to move it to config, but we got no external modules limitation
-	portVal := flag.Uint("p", defaultPort, "port to listen on")
-	maxConns := flag.Uint("m", defaultMaxConns, "max connections limit (0 -> no limit)")
+	defaults := config.Default()
+	configPath := flag.String("c", os.Getenv(config.EnvPrefix+"CONFIG"), "path to JSON config file")
+	portVal := flag.Int("p", defaults.Port, "port to listen on")
+	maxConns := flag.Int("m", defaults.MaxConnections, "max connections limit (0 -> no limit)")
+	maxWorkers := flag.Int("max-workers", defaults.MaxWorkers, "max fetch workers a request may ask for")
+	maxFetchTimeout := flag.Duration("max-fetch-timeout", time.Duration(defaults.MaxFetchTimeout), "max timeout to fetch all urls a request may ask for")
+	maxRequestTimeout := flag.Duration("max-request-timeout", time.Duration(defaults.MaxRequestTimeout), "max timeout for a single url a request may ask for")
 	flag.Parse()
 
-	var port uint16
-	if *portVal > math.MaxUint16 {
-		port = defaultPort
-	} else {
-		port = uint16(*portVal)
+	//loads and validates config, flags take precedence over config file and environment,
+	//but only if they are set explicitly
+	loadConfig := func() (*config.Config, error) {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			return nil, err
+		}
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "p":
+				cfg.Port = *portVal
+			case "m":
+				cfg.MaxConnections = *maxConns
+			case "max-workers":
+				cfg.MaxWorkers = *maxWorkers
+			case "max-fetch-timeout":
+				cfg.MaxFetchTimeout = config.Duration(*maxFetchTimeout)
+			case "max-request-timeout":
+				cfg.MaxRequestTimeout = config.Duration(*maxRequestTimeout)
+			}
+		})
+		if err = cfg.Validate(); err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Failed to start: %s", err.Error())
 	}
 
+	logger, err := logging.Open(loggingConfig(cfg))
+	if err != nil {
+		log.Fatalf("Failed to set-up logging system : %s", err.Error())
+	}
+	defer func() { _ = logger.Close() }()
+	//records of packages, which use the standard logger, go to the same outputs
+	log.SetFlags(0)
+	log.SetOutput(logger.StdLogger(logging.LevelInfo).Writer())
+
+	accessLog, err := openAccessLog(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open access log : %s", err.Error())
+	}
+	if closer, ok := accessLog.(io.Closer); ok {
+		defer func() { _ = closer.Close() }()
+	}
+	opts := muxOptions(cfg, logger)
+	opts.AccessLog = accessLog
+	opts.AccessLogFormat = cfg.AccessLogFormat
+
 	//propagate context to stop requests from being processed
 	serverCtx, serverStop := context.WithCancel(context.Background())
 	defer serverStop()
 
-	mux := http_mux.NewHttpMux(serverCtx, port, *maxConns)
+	mux := http_mux.NewHttpMux(serverCtx, uint16(cfg.Port), uint(cfg.MaxConnections), opts, nil)
 
 	go func() { _ = mux.Run() }()
 
-	//perform graceful shutdown
+	//reload config on SIGHUP, perform graceful shutdown on SIGTERM/SIGINT
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
-	<-quit
+	for running := true; running; {
+		select {
+		case <-reload:
+			cfg = reloadConfig(mux, logger, cfg, loadConfig)
+		case <-quit:
+			running = false
+		}
+	}
+	//fail readiness first, so load balancers drain the instance before the listener is closed,
+	//the second signal skips the delay
+	mux.Drain()
+	if cfg.DrainDelay > 0 {
+		logger.Info("Waiting for load balancers to drain", "drain_delay", time.Duration(cfg.DrainDelay))
+		select {
+		case <-time.After(time.Duration(cfg.DrainDelay)):
+		case <-quit:
+		}
+	}
 	serverStop()
 
 	//give the server a few seconds to close listeners in a gentle way
@@ -49,7 +117,118 @@ func main() {
 	defer cancel()
 
 	if err := mux.Shutdown(ctx); err != nil {
-		log.Printf("Error occured during server shutdown: %s", err.Error())
+		logger.Error("Error occured during server shutdown", "error", err)
 	}
 
 }
+
+//loads a new config and applies it to the mux, returns the config in effect.
+//Invalid config is rejected as a whole, the current one stays in effect.
+func reloadConfig(
+	mux *http_mux.HttpMux,
+	logger *logging.Logger,
+	current *config.Config,
+	load func() (*config.Config, error),
+) *config.Config {
+	logger.Info("Reloading config")
+	next, err := load()
+	if err != nil {
+		logger.Error("Config reload rejected", "error", err)
+		return current
+	}
+	next, changes := config.Reloaded(current, next)
+	if len(changes) == 0 {
+		logger.Info("Config reloaded, nothing changed")
+		return current
+	}
+	mux.Reload(muxOptions(next, logger))
+	logger.SetLevel(loggingConfig(next).Level)
+	for _, change := range changes {
+		logger.Info("Config changed", "change", change)
+	}
+	return next
+}
+
+//opens the access log sink, nil if it's disabled. The file is rotated like the application log
+func openAccessLog(cfg *config.Config) (io.Writer, error) {
+	switch cfg.AccessLog {
+	case "":
+		return nil, nil
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+	return logging.OpenRotatingFile(cfg.AccessLog, loggingConfig(cfg).Rotation)
+}
+
+//logging settings from the config, which is validated already
+func loggingConfig(cfg *config.Config) logging.Config {
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	format, _ := logging.ParseFormat(cfg.LogFormat)
+	return logging.Config{
+		Level:  level,
+		Format: format,
+		File:   cfg.LogFile,
+		Stdout: cfg.LogStdout,
+		Rotation: logging.Rotation{
+			MaxBytes:   cfg.LogMaxBytes,
+			MaxAge:     time.Duration(cfg.LogMaxAge),
+			MaxBackups: cfg.LogMaxBackups,
+		},
+	}
+}
+
+//HttpMux options from the config
+func muxOptions(cfg *config.Config, logger *logging.Logger) http_mux.Options {
+	//0 means no limit in the config, but the default limit in the transport
+	maxConnsPerHost := cfg.MaxConnsPerHost
+	if maxConnsPerHost == 0 {
+		maxConnsPerHost = -1
+	}
+	//the config is validated already
+	allowedNetworks, _ := transport.ParseNetworks(cfg.AllowedNetworks)
+	return http_mux.Options{
+		BindAddress:         cfg.BindAddress,
+		MaxRequestBodyBytes: cfg.MaxRequestBodyBytes,
+		MaxUrlsPerRequest:   cfg.MaxUrlsPerRequest,
+		Workers:             cfg.Workers,
+		MaxWorkers:          cfg.MaxWorkers,
+		FetchTimeout:        time.Duration(cfg.FetchTimeout),
+		MaxFetchTimeout:     time.Duration(cfg.MaxFetchTimeout),
+		RequestTimeout:      time.Duration(cfg.RequestTimeout),
+		MaxRequestTimeout:   time.Duration(cfg.MaxRequestTimeout),
+		MaxResponseBytes:    cfg.MaxResponseBytes,
+		MaxBatchBytes:       cfg.MaxBatchBytes,
+		Retry: http_fetcher.RetryPolicy{
+			MaxAttempts:   cfg.RetryMaxAttempts,
+			BackoffBase:   time.Duration(cfg.RetryBackoffBase),
+			BackoffCap:    time.Duration(cfg.RetryBackoffCap),
+			Jitter:        cfg.RetryJitter,
+			RetryStatuses: cfg.RetryStatuses,
+			RetryErrors:   cfg.RetryErrors,
+		},
+		MaxRetryAttempts: cfg.MaxRetryAttempts,
+		Transport: transport.Config{
+			MaxIdleConns:         cfg.MaxIdleConns,
+			MaxIdleConnsPerHost:  cfg.MaxIdleConnsPerHost,
+			MaxConnsPerHost:      maxConnsPerHost,
+			IdleConnTimeout:      time.Duration(cfg.IdleConnTimeout),
+			KeepAlive:            time.Duration(cfg.KeepAlive),
+			DialTimeout:          time.Duration(cfg.DialTimeout),
+			TLSHandshakeTimeout:  time.Duration(cfg.TLSHandshakeTimeout),
+			DisableHTTP2:         cfg.DisableHTTP2,
+			BlockPrivateNetworks: cfg.BlockPrivateNetworks,
+			AllowedNetworks:      allowedNetworks,
+		},
+		Cache: cache.Config{
+			MaxBytes:   cfg.CacheMaxBytes,
+			DefaultTTL: time.Duration(cfg.CacheDefaultTTL),
+			MaxTTL:     time.Duration(cfg.CacheMaxTTL),
+		},
+		CoalesceRequests: cfg.CoalesceRequests,
+		LegacyRootFetch:  cfg.LegacyRootFetch,
+		Policy:           cfg.Policy(),
+		Logger:           logger,
+	}
+}
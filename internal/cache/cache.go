@@ -0,0 +1,301 @@
+/*
+	The package implements an in-memory cache of upstream responses with LRU eviction, which follows HTTP caching rules.
+*/
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//approximate memory taken by an entry besides the body and headers
+const entryOverhead = 512
+
+// Config
+//cache settings
+type Config struct {
+	MaxBytes   int64         //max size of cached responses, 0 -> cache is disabled
+	DefaultTTL time.Duration //lifetime of responses without freshness info, 0 -> such responses are not cached
+	MaxTTL     time.Duration //max lifetime of a response, 0 -> no limit
+}
+
+// Entry
+//cached upstream response
+type Entry struct {
+	Url          string
+	Response     models.Response //response without request-specific fields and the encoded body
+	Body         []byte          //raw upstream body, every fetch encodes it with its own settings
+	Expires      time.Time       //the response must be revalidated after it
+	ETag         string          //validators for conditional revalidation
+	LastModified string
+	key          string
+	size         int64
+}
+
+// Fresh
+//tells whether the entry may be used without revalidation
+func (e *Entry) Fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+// Revalidatable
+//tells whether the entry may be revalidated with a conditional request
+func (e *Entry) Revalidatable() bool {
+	return e.ETag != "" || e.LastModified != ""
+}
+
+// Stats
+//cache statistics
+type Stats struct {
+	Entries   int
+	Bytes     int64
+	Hits      uint64 //lookups, which found a fresh entry
+	Misses    uint64 //lookups, which found nothing or a stale entry
+	Evictions uint64 //entries removed to free space
+}
+
+// Cache
+//LRU cache of upstream responses bounded by size, safe for concurrent use
+type Cache struct {
+	cfg     Config
+	now     func() time.Time
+	mu      sync.Mutex
+	lru     *list.List               //entries, most recently used first
+	entries map[string]*list.Element //by key
+	vary    map[string][]string      //names of headers, which the response varies on, by method and url
+	stats   Stats
+}
+
+func New(cfg Config) *Cache {
+	return &Cache{
+		cfg:     cfg,
+		now:     time.Now,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+		vary:    map[string][]string{},
+	}
+}
+
+// Cacheable
+//tells whether the response to the request may be cached at all
+func Cacheable(method string, headers map[string]string, body string) bool {
+	if method != http.MethodGet && method != http.MethodHead || body != "" {
+		return false
+	}
+	//conditional requests of the client are passed to upstream as is
+	for name := range headers {
+		switch http.CanonicalHeaderKey(name) {
+		case "If-None-Match", "If-Modified-Since", "Range":
+			return false
+		}
+	}
+	return true
+}
+
+// Lookup
+//returns the entry for the request, it may be stale
+func (c *Cache) Lookup(method, url string, headers map[string]string) (*Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	primary := primaryKey(method, url)
+	element, ok := c.entries[variantKey(primary, c.vary[primary], headers)]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	entry := element.Value.(*Entry)
+	if !entry.Fresh(c.now()) {
+		c.stats.Misses++
+		if !entry.Revalidatable() {
+			c.remove(element)
+			return nil, false
+		}
+		return entry, true
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(element)
+	return entry, true
+}
+
+// Store
+//caches the response to the request with its raw body if upstream headers allow it, returns false if it's not cached
+func (c *Cache) Store(method, url string, headers map[string]string, header http.Header, resp models.Response, body []byte) bool {
+	if !cacheableStatus(resp.StatusCode) || resp.Status != models.StatusOk || resp.Truncated {
+		return false
+	}
+	now := c.now()
+	ttl, ok := c.lifetime(header, hasHeader(headers, "Authorization"), now)
+	if !ok {
+		return false
+	}
+	entry := &Entry{
+		Url:          url,
+		Response:     stripResponse(resp),
+		Body:         body,
+		Expires:      now.Add(ttl),
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+	}
+	if ttl <= 0 && !entry.Revalidatable() {
+		return false
+	}
+	entry.size = entrySize(entry)
+	if entry.size > c.cfg.MaxBytes {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	primary := primaryKey(method, url)
+	vary := varyNames(header)
+	c.vary[primary] = vary
+	entry.key = variantKey(primary, vary, headers)
+	if element, ok := c.entries[entry.key]; ok {
+		c.remove(element)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.stats.Bytes += entry.size
+	for c.stats.Bytes > c.cfg.MaxBytes {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+	return true
+}
+
+// Revalidated
+//extends the lifetime of the entry after upstream confirmed it with 304 Not Modified, returns the updated entry
+func (c *Cache) Revalidated(entry *Entry, header http.Header) *Entry {
+	now := c.now()
+	ttl, _ := c.lifetime(header, false, now)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	updated := *entry
+	updated.Expires = now.Add(ttl)
+	if etag := header.Get("ETag"); etag != "" {
+		updated.ETag = etag
+	}
+	//the entry might have been replaced or evicted meanwhile
+	if element, ok := c.entries[entry.key]; ok && element.Value == entry {
+		element.Value = &updated
+		c.lru.MoveToFront(element)
+	}
+	return &updated
+}
+
+// Purge
+//removes all entries of the url, or all entries if the url is empty, returns the count of removed entries
+func (c *Cache) Purge(url string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	purged := 0
+	for element := c.lru.Front(); element != nil; {
+		next := element.Next()
+		if url == "" || element.Value.(*Entry).Url == url {
+			c.remove(element)
+			purged++
+		}
+		element = next
+	}
+	for primary := range c.vary {
+		if url == "" || strings.HasSuffix(primary, " "+url) {
+			delete(c.vary, primary)
+		}
+	}
+	return purged
+}
+
+// Stats
+//returns a snapshot of the cache statistics
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+func (c *Cache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*Entry)
+	delete(c.entries, entry.key)
+	c.stats.Bytes -= entry.size
+}
+
+func primaryKey(method, url string) string {
+	return method + " " + url
+}
+
+//the key of the response variant, selected by values of the request headers, which the response varies on
+func variantKey(primary string, vary []string, headers map[string]string) string {
+	var key strings.Builder
+	key.WriteString(primary)
+	for _, name := range vary {
+		_, _ = fmt.Fprintf(&key, "\n%s: %s", name, headerValue(headers, name))
+	}
+	return key.String()
+}
+
+func varyNames(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func headerValue(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if http.CanonicalHeaderKey(key) == name {
+			return value
+		}
+	}
+	return ""
+}
+
+func hasHeader(headers map[string]string, name string) bool {
+	return headerValue(headers, name) != ""
+}
+
+//statuses, which are cacheable by default
+func cacheableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent, http.StatusMultipleChoices,
+		http.StatusMovedPermanently, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusGone,
+		http.StatusRequestURITooLong, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+//removes fields, which describe a particular request rather than the response, including the body encoded for it
+func stripResponse(resp models.Response) models.Response {
+	resp.Encoding = ""
+	resp.Response = ""
+	resp.ResponseBase64 = ""
+	resp.Json = nil
+	resp.Index = 0
+	resp.Id = nil
+	resp.Attempts = 0
+	resp.Timing = nil
+	resp.CacheHit = false
+	return resp
+}
+
+func entrySize(entry *Entry) int64 {
+	resp := &entry.Response
+	size := int64(entryOverhead + len(entry.Url) + len(entry.Body))
+	for name, value := range resp.Headers {
+		size += int64(len(name) + len(value))
+	}
+	return size
+}
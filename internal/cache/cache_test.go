@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCache_lifetime(t *testing.T) {
+
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		header     http.Header
+		authorized bool
+		wantTTL    time.Duration
+		wantOk     bool
+	}{
+		{name: "max-age", header: http.Header{"Cache-Control": {"public, max-age=60"}}, wantTTL: time.Minute, wantOk: true},
+		{name: "s-maxage", header: http.Header{"Cache-Control": {"max-age=60, s-maxage=30"}}, wantTTL: 30 * time.Second, wantOk: true},
+		{name: "age", header: http.Header{"Cache-Control": {"max-age=60"}, "Age": {"20"}}, wantTTL: 40 * time.Second, wantOk: true},
+		{name: "max ttl", header: http.Header{"Cache-Control": {"max-age=86400"}}, wantTTL: time.Hour, wantOk: true},
+		{name: "no-store", header: http.Header{"Cache-Control": {"no-store"}}, wantOk: false},
+		{name: "private", header: http.Header{"Cache-Control": {"private, max-age=60"}}, wantOk: false},
+		{name: "no-cache", header: http.Header{"Cache-Control": {"no-cache, max-age=60"}}, wantTTL: 0, wantOk: true},
+		{name: "vary all", header: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}, wantOk: false},
+		{name: "authorized", header: http.Header{"Cache-Control": {"max-age=60"}}, authorized: true, wantOk: false},
+		{name: "authorized public", header: http.Header{"Cache-Control": {"public, max-age=60"}}, authorized: true, wantTTL: time.Minute, wantOk: true},
+		{
+			name:    "expires",
+			header:  http.Header{"Expires": {"Wed, 01 Jun 2022 12:02:00 GMT"}, "Date": {"Wed, 01 Jun 2022 12:00:00 GMT"}},
+			wantTTL: 2 * time.Minute,
+			wantOk:  true,
+		},
+		{name: "invalid expires", header: http.Header{"Expires": {"0"}}, wantTTL: 0, wantOk: true},
+		{name: "default", header: http.Header{}, wantTTL: 10 * time.Second, wantOk: true},
+	}
+	c := New(Config{MaxBytes: 1 << 20, DefaultTTL: 10 * time.Second, MaxTTL: time.Hour})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ttl, ok := c.lifetime(tt.header, tt.authorized, now)
+			assert.Equal(t, tt.wantOk, ok, "storability doesn't match")
+			if ok {
+				assert.Equal(t, tt.wantTTL, ttl, "lifetimes don't match")
+			}
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := New(Config{MaxBytes: 3 * (entryOverhead + 100)})
+	c.now = func() time.Time { return now }
+	response := func(url string) models.Response {
+		return models.Response{Url: url, Status: models.StatusOk, StatusCode: http.StatusOK, Response: url}
+	}
+	fresh := http.Header{"Cache-Control": {"max-age=60"}}
+
+	//fresh entry is served until it expires
+	assert.True(t, c.Store(http.MethodGet, "http://a", nil, fresh, response("http://a"), []byte("http://a")), "response is not stored")
+	entry, ok := c.Lookup(http.MethodGet, "http://a", nil)
+	if assert.True(t, ok, "entry is not found") {
+		assert.True(t, entry.Fresh(now), "entry is not fresh")
+		assert.Equal(t, "http://a", string(entry.Body), "bodies don't match")
+		assert.Empty(t, entry.Response.Response, "encoded body is cached")
+	}
+	_, ok = c.Lookup(http.MethodHead, "http://a", nil)
+	assert.False(t, ok, "entry of other method is found")
+	now = now.Add(2 * time.Minute)
+	_, ok = c.Lookup(http.MethodGet, "http://a", nil)
+	assert.False(t, ok, "expired entry without validators is found")
+
+	//stale entry with validators is kept for revalidation
+	validated := http.Header{"Cache-Control": {"no-cache"}, "Etag": {`"v1"`}}
+	assert.True(t, c.Store(http.MethodGet, "http://b", nil, validated, response("http://b"), []byte("http://b")), "response is not stored")
+	entry, ok = c.Lookup(http.MethodGet, "http://b", nil)
+	if assert.True(t, ok, "entry is not found") {
+		assert.False(t, entry.Fresh(now), "entry is fresh")
+		assert.Equal(t, `"v1"`, entry.ETag, "validators don't match")
+		entry = c.Revalidated(entry, fresh)
+		assert.True(t, entry.Fresh(now), "revalidated entry is not fresh")
+	}
+
+	//variants are selected by the headers listed in Vary
+	varied := http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"accept-language"}}
+	c.Store(http.MethodGet, "http://c", map[string]string{"Accept-Language": "en"}, varied, response("en"), []byte("en"))
+	c.Store(http.MethodGet, "http://c", map[string]string{"accept-language": "de"}, varied, response("de"), []byte("de"))
+	entry, ok = c.Lookup(http.MethodGet, "http://c", map[string]string{"Accept-Language": "en"})
+	if assert.True(t, ok, "variant is not found") {
+		assert.Equal(t, "en", string(entry.Body), "variants don't match")
+	}
+	_, ok = c.Lookup(http.MethodGet, "http://c", nil)
+	assert.False(t, ok, "missing variant is found")
+
+	//least recently used entry is evicted
+	c.Lookup(http.MethodGet, "http://b", nil)
+	c.Store(http.MethodGet, "http://d", nil, fresh, response("http://d"), []byte("http://d"))
+	_, ok = c.Lookup(http.MethodGet, "http://c", map[string]string{"Accept-Language": "de"})
+	assert.False(t, ok, "least recently used entry is not evicted")
+	assert.Equal(t, uint64(1), c.Stats().Evictions, "evictions count doesn't match")
+
+	//responses, which are too large, truncated or failed, are not stored
+	assert.False(t, c.Store(http.MethodGet, "http://e", nil, fresh, response("http://e"), []byte(strings.Repeat("e", 2000))), "large response is stored")
+	truncated := response("http://e")
+	truncated.Truncated = true
+	assert.False(t, c.Store(http.MethodGet, "http://e", nil, fresh, truncated, []byte("http://e")), "truncated response is stored")
+	failed := response("http://e")
+	failed.StatusCode = http.StatusInternalServerError
+	assert.False(t, c.Store(http.MethodGet, "http://e", nil, fresh, failed, []byte("http://e")), "failed response is stored")
+
+	assert.Equal(t, 1, c.Purge("http://c"), "purged count doesn't match")
+	assert.Equal(t, 2, c.Purge(""), "purged count doesn't match")
+	stats := c.Stats()
+	assert.Equal(t, 0, stats.Entries, "cache is not empty")
+	assert.Equal(t, int64(0), stats.Bytes, "cache size is not zero")
+}
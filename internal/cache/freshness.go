@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//returns for how long the response stays fresh and whether it may be stored at all
+func (c *Cache) lifetime(header http.Header, authorized bool, now time.Time) (time.Duration, bool) {
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return 0, false
+	}
+	if _, ok := directives["private"]; ok {
+		return 0, false
+	}
+	_, public := directives["public"]
+	sMaxAge, shared := directives["s-maxage"]
+	if authorized && !public && !shared {
+		return 0, false
+	}
+	for _, name := range varyNames(header) {
+		if name == "*" {
+			return 0, false
+		}
+	}
+
+	var ttl time.Duration
+	maxAge, hasMaxAge := directives["max-age"]
+	switch {
+	case shared:
+		ttl = parseSeconds(sMaxAge)
+	case hasMaxAge:
+		ttl = parseSeconds(maxAge)
+	case header.Get("Expires") != "":
+		//invalid dates, like "0", mean already expired
+		expires, err := http.ParseTime(header.Get("Expires"))
+		if err == nil {
+			date, err := http.ParseTime(header.Get("Date"))
+			if err != nil {
+				date = now
+			}
+			ttl = expires.Sub(date)
+		}
+	default:
+		ttl = c.cfg.DefaultTTL
+	}
+	if age := parseSeconds(header.Get("Age")); age > 0 {
+		ttl -= age
+	}
+	if _, ok := directives["no-cache"]; ok {
+		ttl = 0
+	}
+	if c.cfg.MaxTTL > 0 && ttl > c.cfg.MaxTTL {
+		ttl = c.cfg.MaxTTL
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	return ttl, true
+}
+
+//directives of Cache-Control header with their lowercase names, values without quotes
+func parseCacheControl(value string) map[string]string {
+	directives := map[string]string{}
+	for _, directive := range strings.Split(value, ",") {
+		directive = strings.TrimSpace(directive)
+		if directive == "" {
+			continue
+		}
+		name, arg := directive, ""
+		if i := strings.IndexByte(directive, '='); i >= 0 {
+			name, arg = directive[:i], strings.Trim(directive[i+1:], `"`)
+		}
+		directives[strings.ToLower(strings.TrimSpace(name))] = arg
+	}
+	return directives
+}
+
+func parseSeconds(value string) time.Duration {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,171 @@
+/*
+	The package implements coalescing of identical concurrent calls: callers with the same key share a single call and its result.
+*/
+package coalesce
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Group
+//set of calls in flight by keys, safe for concurrent use
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done    chan struct{} //closed when the call is finished
+	value   interface{}
+	err     error
+	waiters int //callers, which still wait for the result
+	callers int //all callers, which joined the call
+	cancel  context.CancelFunc
+
+	mu        sync.Mutex
+	deadline  time.Time   //the latest deadline of callers
+	unbounded bool        //some caller has no deadline, so the call has none
+	timer     *time.Timer //expires the call at the deadline
+	expired   bool
+}
+
+//context of the call, its deadline is extended while callers with later deadlines join
+type callContext struct {
+	context.Context
+	c *call
+}
+
+func (ctx *callContext) Deadline() (time.Time, bool) {
+	ctx.c.mu.Lock()
+	defer ctx.c.mu.Unlock()
+	if ctx.c.unbounded || ctx.c.timer == nil {
+		return time.Time{}, false
+	}
+	return ctx.c.deadline, true
+}
+
+func (ctx *callContext) Err() error {
+	if ctx.Context.Err() == nil {
+		return nil
+	}
+	ctx.c.mu.Lock()
+	defer ctx.c.mu.Unlock()
+	//the call might be cancelled by the last caller, which gave up at the deadline, before the timer fired
+	if ctx.c.expired || !ctx.c.unbounded && ctx.c.timer != nil && !time.Now().Before(ctx.c.deadline) {
+		return context.DeadlineExceeded
+	}
+	return context.Canceled
+}
+
+//extends the deadline of the call up to the deadline of the joined caller
+func (c *call) extend(ctx context.Context) {
+	deadline, bounded := ctx.Deadline()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.unbounded:
+	case !bounded:
+		c.unbounded = true
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+	case c.timer == nil:
+		c.deadline = deadline
+		c.timer = time.AfterFunc(time.Until(deadline), c.expire)
+	case deadline.After(c.deadline):
+		c.deadline = deadline
+		c.timer.Reset(time.Until(deadline))
+	}
+}
+
+func (c *call) expire() {
+	c.mu.Lock()
+	c.expired = true
+	c.mu.Unlock()
+	c.cancel()
+}
+
+//stops the deadline timer of the finished call
+func (c *call) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+}
+
+func New() *Group {
+	return &Group{calls: map[string]*call{}}
+}
+
+// Do
+//calls fn once for all concurrent callers with the same key and returns its result to every one of them.
+//fn gets a context, which is not bound to any caller and is cancelled only when all callers gave up,
+//so a cancelled caller doesn't break the call for the others. The context has the latest deadline of the callers,
+//or none if some caller has no deadline. shared tells whether the result was shared by several callers.
+func (g *Group) Do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (value interface{}, shared bool, err error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if ok {
+		c.waiters++
+		c.callers++
+		c.extend(ctx)
+	} else {
+		callCtx, cancel := context.WithCancel(context.Background())
+		c = &call{
+			done:    make(chan struct{}),
+			waiters: 1,
+			callers: 1,
+			cancel:  cancel,
+		}
+		c.extend(ctx)
+		g.calls[key] = c
+		go g.run(&callContext{Context: callCtx, c: c}, key, c, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		g.mu.Lock()
+		shared = c.callers > 1
+		g.mu.Unlock()
+		return c.value, shared, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			//nobody needs the result anymore, the next caller starts a new call
+			c.cancel()
+			g.forget(key, c)
+		}
+		g.mu.Unlock()
+		return nil, false, ctx.Err()
+	}
+}
+
+// InFlight
+//returns the count of calls in flight
+func (g *Group) InFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.calls)
+}
+
+func (g *Group) run(ctx context.Context, key string, c *call, fn func(ctx context.Context) (interface{}, error)) {
+	defer c.cancel()
+	defer c.stop()
+	c.value, c.err = fn(ctx)
+	g.mu.Lock()
+	g.forget(key, c)
+	g.mu.Unlock()
+	close(c.done)
+}
+
+//removes the call, unless it's already replaced with a new one
+func (g *Group) forget(key string, c *call) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
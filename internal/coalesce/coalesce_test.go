@@ -0,0 +1,145 @@
+package coalesce
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroup_Do(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		callers     int
+		cancelled   int //callers, which give up before the call is finished
+		wantCalls   int32
+		wantShared  bool
+		wantAborted bool //the call got its context cancelled
+	}{
+		{name: "single", callers: 1, wantCalls: 1},
+		{name: "shared", callers: 5, wantCalls: 1, wantShared: true},
+		{name: "some cancelled", callers: 5, cancelled: 3, wantCalls: 1, wantShared: true},
+		{name: "all cancelled", callers: 3, cancelled: 3, wantCalls: 1, wantAborted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New()
+			var calls int32
+			aborted := make(chan bool, 1)
+			release := make(chan struct{})
+			fn := func(ctx context.Context) (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				select {
+				case <-ctx.Done():
+					aborted <- true
+					return nil, ctx.Err()
+				case <-release:
+					aborted <- false
+					return "result", nil
+				}
+			}
+
+			var wg sync.WaitGroup
+			results := make([]interface{}, tt.callers)
+			shared := make([]bool, tt.callers)
+			cancels := make([]context.CancelFunc, tt.callers)
+			for i := 0; i < tt.callers; i++ {
+				var ctx context.Context
+				ctx, cancels[i] = context.WithCancel(context.Background())
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i], shared[i], _ = g.Do(ctx, "key", fn)
+				}(i)
+			}
+			//wait for all callers to join
+			time.Sleep(50 * time.Millisecond)
+			for i := 0; i < tt.cancelled; i++ {
+				cancels[i]()
+			}
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			assert.Equal(t, tt.wantCalls, atomic.LoadInt32(&calls), "calls count doesn't match")
+			assert.Equal(t, tt.wantAborted, <-aborted, "call cancellation doesn't match")
+			for i := 0; i < tt.callers; i++ {
+				if i < tt.cancelled {
+					assert.Nil(t, results[i], "cancelled caller got a result")
+					continue
+				}
+				assert.Equal(t, "result", results[i], "results don't match")
+				assert.Equal(t, tt.wantShared, shared[i], "sharing doesn't match")
+			}
+			assert.Equal(t, 0, g.InFlight(), "calls are left in flight")
+			for _, cancel := range cancels {
+				cancel()
+			}
+		})
+	}
+}
+
+func TestGroup_DoDeadline(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		timeouts     []time.Duration //timeouts of callers, 0 -> no deadline
+		wantDeadline bool
+		wantErr      error
+		wantDuration time.Duration //approximate duration of the call
+	}{
+		{name: "single", timeouts: []time.Duration{100 * time.Millisecond}, wantDeadline: true,
+			wantErr: context.DeadlineExceeded, wantDuration: 100 * time.Millisecond},
+		{name: "extended", timeouts: []time.Duration{100 * time.Millisecond, 300 * time.Millisecond}, wantDeadline: true,
+			wantErr: context.DeadlineExceeded, wantDuration: 300 * time.Millisecond},
+		{name: "unbounded", timeouts: []time.Duration{100 * time.Millisecond, 0}, wantDuration: 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New()
+			type result struct {
+				deadline bool
+				err      error
+				duration time.Duration
+			}
+			results := make(chan result, 1)
+			started := time.Now()
+			fn := func(ctx context.Context) (interface{}, error) {
+				//wait for all callers to join
+				time.Sleep(50 * time.Millisecond)
+				_, deadline := ctx.Deadline()
+				select {
+				case <-ctx.Done():
+				case <-time.After(500 * time.Millisecond):
+				}
+				results <- result{deadline: deadline, err: ctx.Err(), duration: time.Since(started)}
+				return nil, ctx.Err()
+			}
+
+			var wg sync.WaitGroup
+			for _, timeout := range tt.timeouts {
+				ctx := context.Background()
+				if timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, timeout)
+					defer cancel()
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, _, _ = g.Do(ctx, "key", fn)
+				}()
+				time.Sleep(10 * time.Millisecond)
+			}
+			got := <-results
+			wg.Wait()
+
+			assert.Equal(t, tt.wantDeadline, got.deadline, "deadlines don't match")
+			assert.Equal(t, tt.wantErr, got.err, "errors don't match")
+			assert.InDelta(t, tt.wantDuration.Seconds(), got.duration.Seconds(), 0.08, "durations don't match")
+		})
+	}
+}
@@ -0,0 +1,355 @@
+/*
+	The package implements the service configuration: defaults, overridden by a JSON file and environment variables.
+*/
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/http_fetcher"
+	"github.com/quantum0cat/simple-http-mux/internal/http_mux"
+	"github.com/quantum0cat/simple-http-mux/internal/policy"
+	"github.com/quantum0cat/simple-http-mux/internal/transport"
+	"github.com/quantum0cat/simple-http-mux/pkg/logging"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix
+//prefix of environment variables, which override config fields, e.g. SIMPLE_HTTP_MUX_PORT for "port"
+const EnvPrefix = "SIMPLE_HTTP_MUX_"
+
+// Config
+//service settings, fields tagged with `reload:"restart"` can't be changed by reload
+type Config struct {
+	Port                 int      `json:"port" reload:"restart"`                    //port to listen on
+	BindAddress          string   `json:"bind_address" reload:"restart"`            //address to listen on, all interfaces if empty
+	MaxConnections       int      `json:"max_connections" reload:"restart"`         //max inbound connections, 0 -> no limit
+	MaxUrlsPerRequest    int      `json:"max_urls_per_request"`                     //max urls count in a single request
+	Workers              int      `json:"workers"`                                  //fetch workers count per request
+	MaxWorkers           int      `json:"max_workers"`                              //max fetch workers count a request may ask for
+	FetchTimeout         Duration `json:"fetch_timeout"`                            //timeout to fetch all urls of a request
+	MaxFetchTimeout      Duration `json:"max_fetch_timeout"`                        //max fetch timeout a request may ask for
+	RequestTimeout       Duration `json:"request_timeout"`                          //timeout for a single url
+	MaxRequestTimeout    Duration `json:"max_request_timeout"`                      //max timeout for a single url a request may ask for
+	MaxRequestBodyBytes  int64    `json:"max_request_body_bytes"`                   //max size of inbound request body
+	MaxResponseBytes     int64    `json:"max_response_bytes"`                       //max upstream response body size per url
+	MaxBatchBytes        int64    `json:"max_batch_bytes"`                          //max upstream response bodies size per request
+	RetryMaxAttempts     int      `json:"retry_max_attempts"`                       //attempts count per url including the first one
+	MaxRetryAttempts     int      `json:"max_retry_attempts"`                       //max attempts count per url a request may ask for
+	RetryBackoffBase     Duration `json:"retry_backoff_base"`                       //delay before the first retry, doubled for every next one
+	RetryBackoffCap      Duration `json:"retry_backoff_cap"`                        //max delay between attempts
+	RetryJitter          float64  `json:"retry_jitter"`                             //random deviation of the delay in [0, 1]
+	RetryStatuses        []int    `json:"retry_statuses"`                           //upstream statuses to retry
+	RetryErrors          []string `json:"retry_errors"`                             //error classes to retry: timeout, connection, dns
+	MaxIdleConns         int      `json:"max_idle_conns" reload:"restart"`          //max idle upstream connections to all hosts
+	MaxIdleConnsPerHost  int      `json:"max_idle_conns_per_host" reload:"restart"` //max idle upstream connections kept per host
+	MaxConnsPerHost      int      `json:"max_conns_per_host" reload:"restart"`      //max upstream connections per host, 0 -> no limit
+	IdleConnTimeout      Duration `json:"idle_conn_timeout" reload:"restart"`       //idle upstream connection is closed after it
+	DialTimeout          Duration `json:"dial_timeout" reload:"restart"`            //timeout to establish an upstream connection
+	TLSHandshakeTimeout  Duration `json:"tls_handshake_timeout" reload:"restart"`   //timeout to perform TLS handshake with upstream
+	KeepAlive            Duration `json:"keep_alive" reload:"restart"`              //TCP keep-alive period of upstream connections
+	DisableHTTP2         bool     `json:"disable_http2" reload:"restart"`           //don't try HTTP/2 with upstream
+	BlockPrivateNetworks bool     `json:"block_private_networks" reload:"restart"`  //refuse to fetch non-public addresses
+	AllowedNetworks      []string `json:"allowed_networks" reload:"restart"`        //CIDRs fetched despite block_private_networks
+	AllowedSchemes       []string `json:"allowed_schemes"`                          //schemes of urls clients may fetch
+	AllowHosts           []string `json:"allow_hosts"`                              //host patterns clients may fetch, all if empty
+	DenyHosts            []string `json:"deny_hosts"`                               //host patterns clients may not fetch
+	AllowedPorts         []int    `json:"allowed_ports"`                            //ports clients may fetch, all if empty
+	CacheMaxBytes        int64    `json:"cache_max_bytes" reload:"restart"`         //max size of cached upstream responses, 0 -> no cache
+	CacheDefaultTTL      Duration `json:"cache_default_ttl" reload:"restart"`       //lifetime of cached responses without freshness info
+	CacheMaxTTL          Duration `json:"cache_max_ttl" reload:"restart"`           //max lifetime of cached responses, 0 -> no limit
+	CoalesceRequests     bool     `json:"coalesce_requests"`                        //share identical upstream requests of concurrent requests
+	DrainDelay           Duration `json:"drain_delay"`                              //delay between failing readiness and shutdown on SIGTERM
+	LegacyRootFetch      bool     `json:"legacy_root_fetch"`                        //serve the fetch API on "/" besides "/v1/fetch"
+	LogLevel             string   `json:"log_level"`                                //min level of logged records: debug, info, warn, error
+	LogFormat            string   `json:"log_format" reload:"restart"`              //format of log records: logfmt or json
+	LogFile              string   `json:"log_file" reload:"restart"`                //file to write logs to, no file if empty
+	LogStdout            bool     `json:"log_stdout" reload:"restart"`              //write logs to stdout
+	LogMaxBytes          int64    `json:"log_max_bytes" reload:"restart"`           //log file is rotated before it exceeds the size, 0 -> no limit
+	LogMaxAge            Duration `json:"log_max_age" reload:"restart"`             //log file is rotated after being written for this long, 0 -> no limit
+	LogMaxBackups        int      `json:"log_max_backups" reload:"restart"`         //max rotated log files to keep, 0 -> keep all
+	AccessLog            string   `json:"access_log" reload:"restart"`              //access log file, "stdout", "stderr" or "" -> no access log
+	AccessLogFormat      string   `json:"access_log_format" reload:"restart"`       //format of the access log: common, combined or json
+}
+
+// Default
+//returns config with default values
+func Default() *Config {
+	return &Config{
+		Port:                 10000,
+		MaxConnections:       100,
+		MaxUrlsPerRequest:    20,
+		Workers:              4,
+		MaxWorkers:           4,
+		FetchTimeout:         Duration(10 * time.Second),
+		MaxFetchTimeout:      Duration(10 * time.Second),
+		RequestTimeout:       Duration(1 * time.Second),
+		MaxRequestTimeout:    Duration(1 * time.Second),
+		MaxRequestBodyBytes:  1 << 20,
+		MaxResponseBytes:     4 << 20,
+		MaxBatchBytes:        16 << 20,
+		RetryMaxAttempts:     1,
+		MaxRetryAttempts:     3,
+		RetryBackoffBase:     Duration(100 * time.Millisecond),
+		RetryBackoffCap:      Duration(1 * time.Second),
+		RetryJitter:          0.2,
+		RetryStatuses:        []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		RetryErrors:          []string{http_fetcher.ErrorClassTimeout, http_fetcher.ErrorClassConnection},
+		MaxIdleConns:         100,
+		MaxIdleConnsPerHost:  10,
+		MaxConnsPerHost:      32,
+		IdleConnTimeout:      Duration(90 * time.Second),
+		DialTimeout:          Duration(5 * time.Second),
+		TLSHandshakeTimeout:  Duration(5 * time.Second),
+		KeepAlive:            Duration(30 * time.Second),
+		BlockPrivateNetworks: true,
+		AllowedSchemes:       []string{"http", "https"},
+		CoalesceRequests:     true,
+		LegacyRootFetch:      true,
+		LogLevel:             "info",
+		LogFormat:            string(logging.FormatLogfmt),
+		LogFile:              "logs/all.log",
+		LogStdout:            true,
+		LogMaxBytes:          100 << 20,
+		LogMaxAge:            Duration(24 * time.Hour),
+		LogMaxBackups:        7,
+		AccessLog:            "logs/access.log",
+		AccessLogFormat:      http_mux.AccessLogCombined,
+	}
+}
+
+// Load
+//builds config from defaults, overridden by the JSON file (skipped if path is empty) and then by environment variables.
+//The result is not validated, as it may be overridden further (e.g. by command line flags).
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		if err := cfg.applyFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Reloaded
+//returns the config to apply on reload: next one with restart-only fields kept from current.
+//Also describes every changed field, e.g. "fetch_timeout: 10s -> 5s".
+func Reloaded(current, next *Config) (*Config, []string) {
+	reloaded := *next
+	var changes []string
+	currentValue := reflect.ValueOf(current).Elem()
+	reloadedValue := reflect.ValueOf(&reloaded).Elem()
+	for i := 0; i < currentValue.NumField(); i++ {
+		field := currentValue.Type().Field(i)
+		oldField, newField := currentValue.Field(i), reloadedValue.Field(i)
+		if reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
+			continue
+		}
+		change := fmt.Sprintf("%s: %s -> %s", jsonName(field), formatValue(oldField), formatValue(newField))
+		if field.Tag.Get("reload") == "restart" {
+			change += " (requires restart, ignored)"
+			newField.Set(oldField)
+		}
+		changes = append(changes, change)
+	}
+	return &reloaded, changes
+}
+
+func jsonName(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("json"), ",")[0]
+}
+
+func formatValue(value reflect.Value) string {
+	if value.Kind() == reflect.String {
+		return strconv.Quote(value.String())
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+//overrides fields, which are present in the JSON file
+func (c *Config) applyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+//overrides fields, which have environment variables set, lookup is os.LookupEnv or its replacement in tests
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	value := reflect.ValueOf(c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := EnvPrefix + strings.ToUpper(jsonName(field))
+		env, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setField(value.Field(i), env); err != nil {
+			return fmt.Errorf("invalid value %q of %s: %w", env, name, err)
+		}
+	}
+	return nil
+}
+
+//parses the string into the field according to its type
+func setField(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Slice:
+		//comma separated list
+		items := strings.Split(value, ",")
+		slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setField(slice.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// Validate
+//checks the config, all found problems are reported in a single error
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port <= 65535, "port must be in range 1..65535, got %d", c.Port)
+	check(c.BindAddress == "" || net.ParseIP(c.BindAddress) != nil || !strings.ContainsAny(c.BindAddress, ":/ "),
+		"bind_address must be an IP address or a host name, got %q", c.BindAddress)
+	check(c.MaxConnections >= 0, "max_connections must not be negative, got %d", c.MaxConnections)
+	check(c.MaxUrlsPerRequest > 0, "max_urls_per_request must be positive, got %d", c.MaxUrlsPerRequest)
+	check(c.Workers > 0, "workers must be positive, got %d", c.Workers)
+	check(c.MaxWorkers >= c.Workers, "max_workers must not be less than workers (%d), got %d", c.Workers, c.MaxWorkers)
+	check(c.FetchTimeout > 0, "fetch_timeout must be positive, got %s", c.FetchTimeout)
+	check(c.MaxFetchTimeout >= c.FetchTimeout,
+		"max_fetch_timeout must not be less than fetch_timeout (%s), got %s", c.FetchTimeout, c.MaxFetchTimeout)
+	check(c.RequestTimeout > 0, "request_timeout must be positive, got %s", c.RequestTimeout)
+	check(c.MaxRequestTimeout >= c.RequestTimeout,
+		"max_request_timeout must not be less than request_timeout (%s), got %s", c.RequestTimeout, c.MaxRequestTimeout)
+	check(c.MaxRequestBodyBytes > 0, "max_request_body_bytes must be positive, got %d", c.MaxRequestBodyBytes)
+	check(c.MaxResponseBytes > 0, "max_response_bytes must be positive, got %d", c.MaxResponseBytes)
+	check(c.MaxBatchBytes >= c.MaxResponseBytes,
+		"max_batch_bytes must not be less than max_response_bytes (%d), got %d", c.MaxResponseBytes, c.MaxBatchBytes)
+	check(c.RetryMaxAttempts > 0, "retry_max_attempts must be positive, got %d", c.RetryMaxAttempts)
+	check(c.MaxRetryAttempts >= c.RetryMaxAttempts,
+		"max_retry_attempts must not be less than retry_max_attempts (%d), got %d", c.RetryMaxAttempts, c.MaxRetryAttempts)
+	check(c.RetryBackoffBase >= 0, "retry_backoff_base must not be negative, got %s", c.RetryBackoffBase)
+	check(c.RetryBackoffCap >= c.RetryBackoffBase,
+		"retry_backoff_cap must not be less than retry_backoff_base (%s), got %s", c.RetryBackoffBase, c.RetryBackoffCap)
+	check(c.RetryJitter >= 0 && c.RetryJitter <= 1, "retry_jitter must be in range [0, 1], got %v", c.RetryJitter)
+	for _, status := range c.RetryStatuses {
+		check(status >= 100 && status <= 599, "retry_statuses must contain HTTP statuses, got %d", status)
+	}
+	for _, class := range c.RetryErrors {
+		check(isErrorClass(class), "retry_errors must contain error classes %v, got %q", http_fetcher.ErrorClasses, class)
+	}
+	check(c.MaxIdleConns > 0, "max_idle_conns must be positive, got %d", c.MaxIdleConns)
+	check(c.MaxIdleConnsPerHost > 0, "max_idle_conns_per_host must be positive, got %d", c.MaxIdleConnsPerHost)
+	check(c.MaxConnsPerHost >= 0, "max_conns_per_host must not be negative, got %d", c.MaxConnsPerHost)
+	check(c.IdleConnTimeout > 0, "idle_conn_timeout must be positive, got %s", c.IdleConnTimeout)
+	check(c.DialTimeout > 0, "dial_timeout must be positive, got %s", c.DialTimeout)
+	check(c.TLSHandshakeTimeout > 0, "tls_handshake_timeout must be positive, got %s", c.TLSHandshakeTimeout)
+	check(c.KeepAlive > 0, "keep_alive must be positive, got %s", c.KeepAlive)
+	for _, cidr := range c.AllowedNetworks {
+		_, err := transport.ParseNetworks([]string{cidr})
+		check(err == nil, "allowed_networks must contain CIDR notations, e.g. 10.0.0.0/8, got %q", cidr)
+	}
+	check(len(c.AllowedSchemes) > 0, "allowed_schemes must not be empty")
+	urlPolicy := c.Policy()
+	err := urlPolicy.Validate()
+	check(err == nil, "allowed_schemes, allow_hosts, deny_hosts and allowed_ports must be valid: %v", err)
+	check(c.CacheMaxBytes >= 0, "cache_max_bytes must not be negative, got %d", c.CacheMaxBytes)
+	check(c.CacheDefaultTTL >= 0, "cache_default_ttl must not be negative, got %s", c.CacheDefaultTTL)
+	check(c.CacheMaxTTL >= 0, "cache_max_ttl must not be negative, got %s", c.CacheMaxTTL)
+	check(c.DrainDelay >= 0, "drain_delay must not be negative, got %s", c.DrainDelay)
+	check(c.LogFile != "" || c.LogStdout, "logs must be written somewhere, set log_file or log_stdout")
+	_, err = logging.ParseLevel(c.LogLevel)
+	check(err == nil, "log_level must be one of debug, info, warn, error, got %q", c.LogLevel)
+	_, err = logging.ParseFormat(c.LogFormat)
+	check(err == nil, "log_format must be logfmt or json, got %q", c.LogFormat)
+	check(c.LogMaxBytes >= 0, "log_max_bytes must not be negative, got %d", c.LogMaxBytes)
+	check(c.LogMaxAge >= 0, "log_max_age must not be negative, got %s", c.LogMaxAge)
+	check(c.LogMaxBackups >= 0, "log_max_backups must not be negative, got %d", c.LogMaxBackups)
+	check(contains(http_mux.AccessLogFormats, c.AccessLogFormat),
+		"access_log_format must be one of %v, got %q", http_mux.AccessLogFormats, c.AccessLogFormat)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func isErrorClass(class string) bool {
+	return contains(http_fetcher.ErrorClasses, class)
+}
+
+func contains(list []string, item string) bool {
+	for _, known := range list {
+		if item == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy
+//returns the policy of urls clients may fetch
+func (c *Config) Policy() policy.Policy {
+	return policy.Policy{
+		Schemes:    c.AllowedSchemes,
+		AllowHosts: c.AllowHosts,
+		DenyHosts:  c.DenyHosts,
+		Ports:      c.AllowedPorts,
+	}
+}
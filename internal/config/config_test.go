@@ -0,0 +1,199 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+
+	dir := t.TempDir()
+	validFile := filepath.Join(dir, "valid.json")
+	err := os.WriteFile(validFile, []byte(`{"port": 8080, "fetch_timeout": "5s", "log_stdout": false}`), 0644)
+	assert.NoError(t, err, "failed to write config file")
+	unknownFile := filepath.Join(dir, "unknown.json")
+	err = os.WriteFile(unknownFile, []byte(`{"prot": 8080}`), 0644)
+	assert.NoError(t, err, "failed to write config file")
+
+	tests := []struct {
+		name    string
+		path    string
+		env     map[string]string
+		want    func(cfg *Config)
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: func(cfg *Config) {},
+		},
+		{
+			name: "file",
+			path: validFile,
+			want: func(cfg *Config) {
+				cfg.Port = 8080
+				cfg.FetchTimeout = Duration(5 * time.Second)
+				cfg.LogStdout = false
+			},
+		},
+		{
+			name: "env overrides file",
+			path: validFile,
+			env: map[string]string{
+				"SIMPLE_HTTP_MUX_PORT":          "9090",
+				"SIMPLE_HTTP_MUX_BIND_ADDRESS":  "127.0.0.1",
+				"SIMPLE_HTTP_MUX_FETCH_TIMEOUT": "7s",
+			},
+			want: func(cfg *Config) {
+				cfg.Port = 9090
+				cfg.BindAddress = "127.0.0.1"
+				cfg.FetchTimeout = Duration(7 * time.Second)
+				cfg.LogStdout = false
+			},
+		},
+		{
+			name:    "unknown field",
+			path:    unknownFile,
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			path:    filepath.Join(dir, "missing.json"),
+			wantErr: true,
+		},
+		{
+			name:    "invalid env",
+			env:     map[string]string{"SIMPLE_HTTP_MUX_WORKERS": "many"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := Load(tt.path)
+			if tt.wantErr {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+			assert.NoError(t, err, "failed to load config")
+			want := Default()
+			tt.want(want)
+			assert.Equal(t, want, cfg, "configs don't match")
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr bool
+	}{
+		{
+			name:   "default",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name:    "port out of range",
+			modify:  func(cfg *Config) { cfg.Port = 70000 },
+			wantErr: true,
+		},
+		{
+			name:    "max workers less than workers",
+			modify:  func(cfg *Config) { cfg.MaxWorkers = 2 },
+			wantErr: true,
+		},
+		{
+			name:   "no upstream connections limit",
+			modify: func(cfg *Config) { cfg.MaxConnsPerHost = 0 },
+		},
+		{
+			name:    "negative upstream connections limit",
+			modify:  func(cfg *Config) { cfg.MaxConnsPerHost = -1 },
+			wantErr: true,
+		},
+		{
+			name:    "unknown log level",
+			modify:  func(cfg *Config) { cfg.LogLevel = "verbose" },
+			wantErr: true,
+		},
+		{
+			name:   "stdout only logs",
+			modify: func(cfg *Config) { cfg.LogFile = "" },
+		},
+		{
+			name:    "unknown access log format",
+			modify:  func(cfg *Config) { cfg.AccessLogFormat = "apache" },
+			wantErr: true,
+		},
+		{
+			name:   "no access log",
+			modify: func(cfg *Config) { cfg.AccessLog = "" },
+		},
+		{
+			name:   "allowed networks",
+			modify: func(cfg *Config) { cfg.AllowedNetworks = []string{"10.0.0.0/8", "fd00::/8"} },
+		},
+		{
+			name:    "invalid allowed network",
+			modify:  func(cfg *Config) { cfg.AllowedNetworks = []string{"10.0.0.1"} },
+			wantErr: true,
+		},
+		{
+			name:   "url policy",
+			modify: func(cfg *Config) { cfg.AllowHosts, cfg.DenyHosts = []string{".example.com"}, []string{"*.internal"} },
+		},
+		{
+			name:    "invalid url policy",
+			modify:  func(cfg *Config) { cfg.AllowedPorts = []int{0} },
+			wantErr: true,
+		},
+		{
+			name:    "no allowed schemes",
+			modify:  func(cfg *Config) { cfg.AllowedSchemes = nil },
+			wantErr: true,
+		},
+		{
+			name:    "no log output",
+			modify:  func(cfg *Config) { cfg.LogFile, cfg.LogStdout = "", false },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.wantErr {
+				assert.Error(t, err, "expected an error")
+			} else {
+				assert.NoError(t, err, "unexpected error")
+			}
+		})
+	}
+}
+
+func TestReloaded(t *testing.T) {
+
+	current := Default()
+	next := Default()
+	next.Port = 8080
+	next.FetchTimeout = Duration(5 * time.Second)
+	next.BindAddress = "127.0.0.1"
+
+	reloaded, changes := Reloaded(current, next)
+
+	want := Default()
+	want.FetchTimeout = Duration(5 * time.Second)
+	assert.Equal(t, want, reloaded, "configs don't match")
+	assert.Equal(t, []string{
+		`port: 10000 -> 8080 (requires restart, ignored)`,
+		`bind_address: "" -> "127.0.0.1" (requires restart, ignored)`,
+		`fetch_timeout: 10s -> 5s`,
+	}, changes, "changes don't match")
+}
@@ -0,0 +1,65 @@
+package http_fetcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"net/http"
+)
+
+//result of fetchUrlWithRetries with the raw body, shared by coalesced fetches
+type sharedFetch struct {
+	resp     *models.Response
+	body     []byte
+	attempts int
+}
+
+//fetches the url like fetchUrlWithRetries, but identical GET/HEAD requests in flight of all fetches
+//share a single upstream request. The request is cancelled only when all fetches waiting for it are cancelled,
+//it lasts until the latest deadline of them. Every fetch applies its own size limits and encoding to the body.
+//Also tells whether the result, either a response or an error, was shared with other fetches
+func (h *HttpFetcher) fetchUrlShared(
+	ctx context.Context,
+	client *http.Client,
+	spec models.UrlSpec,
+) (*models.Response, int, bool, error) {
+	if h.coalesce == nil || (spec.Method != http.MethodGet && spec.Method != http.MethodHead) || spec.Body != "" {
+		resp, body, attempts, err := h.fetchUrlWithRetries(ctx, client, spec)
+		if err == nil {
+			err = h.applyBody(resp, body)
+		}
+		if err != nil {
+			return nil, attempts, false, err
+		}
+		return resp, attempts, false, nil
+	}
+	value, shared, err := h.coalesce.Do(ctx, h.coalesceKey(&spec), func(ctx context.Context) (interface{}, error) {
+		resp, body, attempts, err := h.fetchUrlWithRetries(ctx, client, spec)
+		return sharedFetch{resp: resp, body: body, attempts: attempts}, err
+	})
+	if value == nil {
+		//the fetch gave up waiting, no attempts were made for it
+		return nil, 0, shared, err
+	}
+	result := value.(sharedFetch)
+	if result.resp == nil {
+		return nil, result.attempts, shared, err
+	}
+	//every fetch gets its own copy of the response
+	resp := *result.resp
+	resp.Coalesced = shared
+	if err == nil {
+		err = h.applyBody(&resp, result.body)
+	}
+	if err != nil {
+		return nil, result.attempts, shared, err
+	}
+	return &resp, result.attempts, shared, nil
+}
+
+//identifies the upstream request and the fetch settings, which affect its result.
+//The shared request runs with the read limit, the timeout and the retry policy of the fetch, which started it,
+//so they are the part of the key
+func (h *HttpFetcher) coalesceKey(spec *models.UrlSpec) string {
+	return fmt.Sprintf("%s\n%d %t %s %+v", specKey(spec), h.readLimit(), h.noCache, h.requestTimeout, h.retry)
+}
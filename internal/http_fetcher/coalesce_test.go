@@ -0,0 +1,165 @@
+package http_fetcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/coalesce"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHttpFetcher_FetchCoalesced(t *testing.T) {
+
+	var requests int32
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			time.Sleep(200 * time.Millisecond)
+			_, _ = fmt.Fprintf(w, testServerResponseFormat)
+		},
+	))
+	defer testServer.Close()
+
+	tests := []struct {
+		name          string
+		method        string
+		fetches       int
+		varyTimeouts  bool //every fetch has its own request timeout
+		wantRequests  int32
+		wantCoalesced bool
+	}{
+		{name: "get", method: http.MethodGet, fetches: 3, wantRequests: 1, wantCoalesced: true},
+		{name: "post", method: http.MethodPost, fetches: 3, wantRequests: 3},
+		{name: "different timeouts", method: http.MethodGet, fetches: 2, varyTimeouts: true, wantRequests: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			group := coalesce.New()
+			var wg sync.WaitGroup
+			resps := make([][]models.Response, tt.fetches)
+			for i := 0; i < tt.fetches; i++ {
+				opts := Options{MaxWorkers: 1, Method: tt.method, RequestTimeout: time.Second, Coalesce: group}
+				if tt.varyTimeouts {
+					opts.RequestTimeout += time.Duration(i) * time.Second
+				}
+				fetcher, err := NewHttpFetcher(strconv.Itoa(i), models.NewUrlSpecs([]string{testServer.URL}), opts)
+				assert.NoError(t, err, "failed to construct HttpFetcher")
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					resps[i], err = fetcher.Fetch(context.Background())
+					assert.NoError(t, err, "finished with error")
+				}(i)
+			}
+			wg.Wait()
+
+			assert.Equal(t, tt.wantRequests, atomic.LoadInt32(&requests), "upstream requests count doesn't match")
+			for i := range resps {
+				if assert.Len(t, resps[i], 1, "responses count doesn't match") {
+					assert.Equal(t, testServerResponseFormat, resps[i][0].Response, "responses don't match")
+					assert.Equal(t, tt.wantCoalesced, resps[i][0].Coalesced, "coalescing doesn't match")
+				}
+			}
+		})
+	}
+}
+
+func TestHttpFetcher_FetchCoalescedFailure(t *testing.T) {
+
+	var requests int32
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			time.Sleep(200 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	))
+	defer testServer.Close()
+
+	group := coalesce.New()
+	opts := Options{MaxWorkers: 1, RequestTimeout: 100 * time.Millisecond, Coalesce: group}
+	var wg sync.WaitGroup
+	resps := make([][]models.Response, 2)
+	for i := range resps {
+		fetcher, err := NewHttpFetcher(strconv.Itoa(i), models.NewUrlSpecs([]string{testServer.URL}), opts)
+		assert.NoError(t, err, "failed to construct HttpFetcher")
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resps[i], err = fetcher.Fetch(context.Background())
+			assert.NoError(t, err, "finished with error")
+		}(i)
+	}
+	wg.Wait()
+
+	//the shared failure is reported as coalesced with the attempts made for it
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "upstream requests count doesn't match")
+	for i := range resps {
+		if assert.Len(t, resps[i], 1, "responses count doesn't match") {
+			assert.Equal(t, models.StatusTimeout, resps[i][0].Status, "statuses don't match")
+			assert.True(t, resps[i][0].Coalesced, "failure is not coalesced")
+			assert.Equal(t, 1, resps[i][0].Attempts, "attempts don't match")
+		}
+	}
+}
+
+func TestHttpFetcher_FetchCoalescedLimits(t *testing.T) {
+
+	var requests int32
+	body := strings.Repeat("a", 100)
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			time.Sleep(200 * time.Millisecond)
+			_, _ = fmt.Fprint(w, body)
+		},
+	))
+	defer testServer.Close()
+
+	//every fetch applies its own limits to the shared body
+	group := coalesce.New()
+	batchLimits := []int64{20, 0, 20}
+	failOnTruncate := []bool{false, false, true}
+	wantLengths := []int{20, 100, 0}
+	wantStatuses := []string{models.StatusOk, models.StatusOk, models.StatusError}
+
+	var wg sync.WaitGroup
+	resps := make([][]models.Response, len(batchLimits))
+	for i := range batchLimits {
+		opts := Options{
+			MaxWorkers:            1,
+			RequestTimeout:        time.Second,
+			MaxResponseBytes:      1000,
+			MaxBatchResponseBytes: batchLimits[i],
+			FailOnTruncate:        failOnTruncate[i],
+			Coalesce:              group,
+		}
+		fetcher, err := NewHttpFetcher(strconv.Itoa(i), models.NewUrlSpecs([]string{testServer.URL}), opts)
+		assert.NoError(t, err, "failed to construct HttpFetcher")
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resps[i], err = fetcher.Fetch(context.Background())
+			assert.NoError(t, err, "finished with error")
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "upstream requests count doesn't match")
+	for i := range resps {
+		if assert.Len(t, resps[i], 1, "responses count doesn't match") {
+			assert.Equal(t, wantStatuses[i], resps[i][0].Status, "statuses don't match")
+			assert.Len(t, resps[i][0].Response, wantLengths[i], "body lengths don't match")
+			assert.True(t, resps[i][0].Coalesced, "response is not coalesced")
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package http_fetcher
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+//puts the body into the response: text as is, JSON as raw JSON if asked, anything else as base64
+func encodeBody(resp *models.Response, body []byte, truncated bool, decodeJson bool) {
+	contentType := resp.ContentType
+	if contentType == "" && len(body) > 0 {
+		contentType = http.DetectContentType(body)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
+
+	if decodeJson && !truncated && isJsonMediaType(mediaType) && json.Valid(body) {
+		resp.Encoding = models.EncodingJson
+		resp.Json = body
+		return
+	}
+	if isTextMediaType(mediaType) {
+		text := body
+		if truncated {
+			text = trimIncompleteRune(text)
+		}
+		if utf8.Valid(text) {
+			resp.Encoding = models.EncodingText
+			resp.Response = string(text)
+			return
+		}
+	}
+	resp.Encoding = models.EncodingBase64
+	resp.ResponseBase64 = base64.StdEncoding.EncodeToString(body)
+}
+
+func isJsonMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isTextMediaType(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		isJsonMediaType(mediaType),
+		mediaType == "application/xml",
+		strings.HasSuffix(mediaType, "+xml"),
+		mediaType == "application/javascript",
+		mediaType == "application/x-www-form-urlencoded":
+		return true
+	}
+	return false
+}
+
+//cuts a multibyte character, which was split by truncation, off the end of data
+func trimIncompleteRune(data []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return data
+}
@@ -0,0 +1,81 @@
+package http_fetcher
+
+import (
+	"encoding/base64"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_encodeBody(t *testing.T) {
+
+	binary := []byte{0x1f, 0x8b, 0x08, 0x00, 0xff}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		truncated   bool
+		decodeJson  bool
+		want        models.Response
+	}{
+		{
+			name:        "text",
+			contentType: "text/plain; charset=utf-8",
+			body:        []byte("text"),
+			want:        models.Response{Encoding: models.EncodingText, Response: "text"},
+		},
+		{
+			name:        "binary",
+			contentType: "application/gzip",
+			body:        binary,
+			want:        models.Response{Encoding: models.EncodingBase64, ResponseBase64: base64.StdEncoding.EncodeToString(binary)},
+		},
+		{
+			name:        "not utf-8 text",
+			contentType: "text/plain",
+			body:        []byte{'a', 0xff, 'b'},
+			want:        models.Response{Encoding: models.EncodingBase64, ResponseBase64: base64.StdEncoding.EncodeToString([]byte{'a', 0xff, 'b'})},
+		},
+		{
+			name:        "truncated utf-8 text",
+			contentType: "text/plain",
+			body:        []byte("ab\xd0"),
+			truncated:   true,
+			want:        models.Response{Encoding: models.EncodingText, Response: "ab"},
+		},
+		{
+			name: "no content type",
+			body: []byte("<html></html>"),
+			want: models.Response{Encoding: models.EncodingText, Response: "<html></html>"},
+		},
+		{
+			name:        "json as text",
+			contentType: "application/json",
+			body:        []byte(`{"a":1}`),
+			want:        models.Response{Encoding: models.EncodingText, Response: `{"a":1}`},
+		},
+		{
+			name:        "json decoded",
+			contentType: "application/problem+json",
+			body:        []byte(`{"a":1}`),
+			decodeJson:  true,
+			want:        models.Response{Encoding: models.EncodingJson, Json: []byte(`{"a":1}`)},
+		},
+		{
+			name:        "invalid json",
+			contentType: "application/json",
+			body:        []byte(`{"a":`),
+			decodeJson:  true,
+			want:        models.Response{Encoding: models.EncodingText, Response: `{"a":`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := models.Response{ContentType: tt.contentType}
+			encodeBody(&resp, tt.body, tt.truncated, tt.decodeJson)
+			tt.want.ContentType = tt.contentType
+			assert.Equal(t, tt.want, resp, "responses don't match")
+		})
+	}
+}
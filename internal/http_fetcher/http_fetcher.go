@@ -4,16 +4,29 @@
 package http_fetcher
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/cache"
+	"github.com/quantum0cat/simple-http-mux/internal/coalesce"
 	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/quantum0cat/simple-http-mux/internal/policy"
+	"github.com/quantum0cat/simple-http-mux/internal/transport"
 	"github.com/quantum0cat/simple-http-mux/pkg/errgroup"
+	"github.com/quantum0cat/simple-http-mux/pkg/logging"
+	"github.com/quantum0cat/simple-http-mux/pkg/urlutil"
 	"github.com/quantum0cat/simple-http-mux/pkg/utils"
+	"io"
 	"io/ioutil"
-	"log"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -21,60 +34,255 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
+//max redirects to follow for a single url
+const maxRedirects = 10
+
+// RequestIdHeader
+//header, which carries the request id to upstream, unless the url spec sets it
+const RequestIdHeader = "X-Request-ID"
+
+// DefaultResponseHeaders
+//upstream response headers, which are reported in models.Response
+var DefaultResponseHeaders = []string{
+	"Cache-Control",
+	"Content-Encoding",
+	"Date",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+	"Location",
+	"Retry-After",
+	"Server",
+}
+
+// Options
+//settings of a single fetch
+type Options struct {
+	MaxWorkers     int               //max worker goroutines
+	FetchTimeout   time.Duration     //timeout to fetch all urls or cancel
+	RequestTimeout time.Duration     //timeout for single request
+	FailFast       bool              //abort the whole fetch on the first failed url
+	Method         string            //HTTP method of upstream requests, GET if empty
+	Headers        map[string]string //headers of upstream requests
+	Body           string            //body of upstream requests
+	//limits of upstream response bodies, bodies are truncated at the limit, 0 -> no limit
+	MaxResponseBytes      int64 //per url
+	MaxBatchResponseBytes int64 //for all urls of the fetch
+	FailOnTruncate        bool  //fail the url with ErrResponseTooLarge instead of truncation
+	DecodeJson            bool  //embed JSON bodies as raw JSON
+	Retry                 RetryPolicy
+	Transport             http.RoundTripper //transport of upstream requests, http.DefaultTransport if nil
+	Cache                 *cache.Cache      //cache of upstream responses, nil -> no caching
+	NoCache               bool              //revalidate cached responses instead of serving them as is
+	Coalesce              *coalesce.Group   //shares identical GET/HEAD requests with other fetches, nil -> no sharing
+	Observer              Observer          //receives fetch events, may be nil
+	Logger                *logging.Logger   //logger of the fetch, records are tagged with the request id, nil -> no logs
+	Policy                policy.Policy     //restricts urls to fetch including redirects, zero value allows http and https
+}
+
+// Observer
+//receives events of fetches, e.g. to collect metrics, must be safe for concurrent use
+type Observer interface {
+	WorkerStarted()
+	WorkerStopped()
+	//called for every unique url of the fetch, which was fetched or failed
+	UrlFetched(resp *models.Response, duration time.Duration)
+}
+
 type HttpFetcher struct {
-	rid            uint32        //request id, for debugging purposes
-	urls           []string      //urls list to process
-	maxWorkers     int           //max worker goroutines
-	fetchTimeout   time.Duration //timeout to fetch all urls or cancel
-	requestTimeout time.Duration //timeout for single request
+	rid             string            //request id, forwarded to upstream and used in logs
+	specs           []models.UrlSpec  //unique url specs to process, with Options applied
+	positions       []int             //index in specs for every url of the original list
+	ids             []json.RawMessage //client ids for every url of the original list
+	urls            []string          //urls of the original list as the client sent them
+	maxWorkers      int               //max worker goroutines
+	fetchTimeout    time.Duration     //timeout to fetch all urls or cancel
+	requestTimeout  time.Duration     //timeout for single request
+	failFast        bool              //abort the whole fetch on the first failed url
+	responseHeaders []string          //upstream response headers to report
+	maxBytes        int64             //max response body size per url, 0 -> no limit
+	maxBatchBytes   int64             //max response bodies size of the whole fetch, 0 -> no limit
+	batchBudget     *int64            //bytes left of maxBatchBytes, nil -> no limit
+	failOnTruncate  bool              //fail the url instead of truncation
+	decodeJson      bool              //embed JSON bodies as raw JSON
+	retry           RetryPolicy       //retry policy of failed urls
+	transport       http.RoundTripper //transport of upstream requests, shared with other fetches
+	cache           *cache.Cache      //cache of upstream responses, shared with other fetches, may be nil
+	noCache         bool              //revalidate cached responses instead of serving them as is
+	coalesce        *coalesce.Group   //identical requests in flight, shared with other fetches, may be nil
+	observer        Observer          //receives fetch events, may be nil
+	log             *logging.Logger   //logger with the request id field
+	policy          policy.Policy     //restricts urls to fetch including redirects
 }
 
-func NewHttpFetcher(
-	rid uint32,
-	urls []string,
-	maxWorkers int,
-	fetchTimeout time.Duration,
-	requestTimeout time.Duration,
-) (*HttpFetcher, error) {
+// InvalidUrlsError
+//urls, which can't be fetched as they are invalid, nothing is fetched then
+type InvalidUrlsError struct {
+	Urls []models.InvalidUrl
+}
+
+func (e *InvalidUrlsError) Error() string {
+	reasons := make([]string, len(e.Urls))
+	for i, invalid := range e.Urls {
+		reasons[i] = fmt.Sprintf("%q: %s", invalid.Url, invalid.Reason)
+	}
+	return "invalid urls: " + strings.Join(reasons, "; ")
+}
+
+// NewHttpFetcher
+//creates a fetcher of the urls, which are normalized first, so equivalent urls are fetched once.
+//Returns InvalidUrlsError, which lists every invalid url, if there are any
+func NewHttpFetcher(rid string, specs []models.UrlSpec, opts Options) (*HttpFetcher, error) {
 
 	//validate
-	if len(urls) == 0 {
+	if len(specs) == 0 {
 		return nil, fmt.Errorf("failed to construct an HttpFetcher, urls list is empty")
 	}
 
-	//remove url duplicates, we don't need to do extra job
-	urls = utils.RemoveDuplicates(urls)
+	//normalize urls and apply fetch-wide options to every url, then remove duplicates, we don't need to do extra job
+	keys := make([]string, len(specs))
+	ids := make([]json.RawMessage, len(specs))
+	urls := make([]string, len(specs))
+	resolved := make(map[string]models.UrlSpec, len(specs))
+	var invalid []models.InvalidUrl
+	for i, spec := range specs {
+		urls[i] = spec.Url
+		normalized, err := urlutil.Normalize(spec.Url)
+		if err != nil {
+			invalid = append(invalid, models.InvalidUrl{Index: i, Url: spec.Url, Reason: err.Error()})
+			continue
+		}
+		spec.Url = normalized
+		spec = resolveSpec(spec, &opts)
+		keys[i] = specKey(&spec)
+		ids[i] = spec.Id
+		spec.Id = nil
+		resolved[keys[i]] = spec
+	}
+	if len(invalid) > 0 {
+		return nil, &InvalidUrlsError{Urls: invalid}
+	}
+	keys, positions := utils.IndexDuplicates(keys)
+	unique := make([]models.UrlSpec, len(keys))
+	for i, key := range keys {
+		unique[i] = resolved[key]
+	}
+
+	roundTripper := opts.Transport
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = logging.Discard()
+	}
 
+	maxWorkers := opts.MaxWorkers
 	if maxWorkers < 1 {
 		maxWorkers = 1
 	}
-	if maxWorkers > len(urls) {
-		maxWorkers = len(urls)
+	if maxWorkers > len(unique) {
+		maxWorkers = len(unique)
 	}
 
 	return &HttpFetcher{
-			rid:            rid,
-			urls:           urls,
-			maxWorkers:     maxWorkers,
-			fetchTimeout:   fetchTimeout,
-			requestTimeout: requestTimeout,
+			rid:             rid,
+			specs:           unique,
+			positions:       positions,
+			ids:             ids,
+			urls:            urls,
+			maxWorkers:      maxWorkers,
+			fetchTimeout:    opts.FetchTimeout,
+			requestTimeout:  opts.RequestTimeout,
+			failFast:        opts.FailFast,
+			responseHeaders: DefaultResponseHeaders,
+			maxBytes:        opts.MaxResponseBytes,
+			maxBatchBytes:   opts.MaxBatchResponseBytes,
+			failOnTruncate:  opts.FailOnTruncate,
+			decodeJson:      opts.DecodeJson,
+			retry:           opts.Retry,
+			transport:       roundTripper,
+			cache:           opts.Cache,
+			noCache:         opts.NoCache,
+			coalesce:        opts.Coalesce,
+			observer:        opts.Observer,
+			log:             logger.With("rid", rid),
+			policy:          opts.Policy,
 		},
 		nil
 }
 
+//fills the spec with fetch-wide method, headers and body, the spec's own settings take precedence
+func resolveSpec(spec models.UrlSpec, opts *Options) models.UrlSpec {
+	if spec.Method == "" {
+		spec.Method = opts.Method
+	}
+	if spec.Method == "" {
+		spec.Method = http.MethodGet
+	}
+	if spec.Body == "" {
+		spec.Body = opts.Body
+	}
+	if len(opts.Headers) > 0 {
+		headers := make(map[string]string, len(opts.Headers)+len(spec.Headers))
+		for name, value := range opts.Headers {
+			headers[http.CanonicalHeaderKey(name)] = value
+		}
+		for name, value := range spec.Headers {
+			headers[http.CanonicalHeaderKey(name)] = value
+		}
+		spec.Headers = headers
+	}
+	return spec
+}
+
+//identifies the upstream request described by the spec, client id is not a part of it
+func specKey(spec *models.UrlSpec) string {
+	names := make([]string, 0, len(spec.Headers))
+	for name := range spec.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	_, _ = fmt.Fprintf(&key, "%s %s %d\n", spec.Method, spec.Url, spec.TimeoutMs)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(&key, "%s: %s\n", http.CanonicalHeaderKey(name), spec.Headers[name])
+	}
+	key.WriteString(spec.Body)
+	return key.String()
+}
+
 // Fetch
-//fetches multiple urls concurrently, can be cancelled by ctx
+//fetches multiple urls concurrently, can be cancelled by ctx.
+//Responses are returned in the order of the original urls list, duplicates share the result of a single fetch.
+//By default every url gets its own entry with a status, even if it failed or was not fetched in time.
+//In fail-fast mode the first failed url cancels the fetch and its error is returned.
 func (h *HttpFetcher) Fetch(ctx context.Context) ([]models.Response, error) {
-	log.Printf(utils.WithRid("Fetch started", h.rid))
-	urlCh := make(chan string)
-	respCh := make(chan models.Response)
+	responses := make([]models.Response, len(h.positions))
+	err := h.FetchEach(ctx, func(resp models.Response) {
+		responses[resp.Index] = resp
+	})
+	if err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
 
-	//generate input for workers
-	go func(urls []string, urlCh chan string) {
-		for _, url := range urls {
-			urlCh <- url
-		}
-	}(h.urls, urlCh)
+// FetchEach
+//fetches urls like Fetch, but passes every response to onResponse as soon as it's ready, in completion order.
+//onResponse is never called concurrently, slow onResponse slows down the fetch.
+//In fail-fast mode responses, passed before the failure, are not revoked.
+func (h *HttpFetcher) FetchEach(ctx context.Context, onResponse func(models.Response)) error {
+	h.log.Debug("Fetch started", "urls", len(h.specs), "workers", h.maxWorkers)
+	started := time.Now()
+	if h.maxBatchBytes > 0 {
+		budget := h.maxBatchBytes
+		h.batchBudget = &budget
+	}
+	idxCh := make(chan int)
+	resultCh := make(chan fetchResult)
 
 	var cancel context.CancelFunc
 	if h.fetchTimeout > 0 {
@@ -83,26 +291,56 @@ func (h *HttpFetcher) Fetch(ctx context.Context) ([]models.Response, error) {
 		ctx, cancel = context.WithCancel(ctx)
 	}
 	defer cancel()
+	fetchCtx := ctx
 
 	errGroup, ctx := errgroup.WithContext(ctx)
 
+	//generate input for workers
+	go func(count int, idxCh chan int) {
+		for idx := 0; idx < count; idx++ {
+			select {
+			case <-ctx.Done():
+				return
+			case idxCh <- idx:
+			}
+		}
+	}(len(h.specs), idxCh)
+
 	//init workers
 	for wid := 0; wid < h.maxWorkers; wid++ {
 		errGroup.Go(func() error {
-			err := h.fetchUrlWorker(ctx, urlCh, respCh, h.requestTimeout)
+			err := h.fetchUrlWorker(ctx, idxCh, resultCh)
 			return err
 		})
 	}
 
-	//collect results into resulting slice
-	var responses []models.Response
+	//original list indices for every unique url
+	waiting := make([][]int, len(h.specs))
+	for i, pos := range h.positions {
+		waiting[pos] = append(waiting[pos], i)
+	}
+	//passes the result of a unique url to every its occurrence in the original list
+	emit := func(idx int, resp models.Response) {
+		for _, i := range waiting[idx] {
+			resp.Index = i
+			resp.Id = h.ids[i]
+			resp.Url = h.urls[i]
+			onResponse(resp)
+		}
+	}
+
+	//pass results as soon as they arrive
+	fetched := make([]bool, len(h.specs))
+	fetchedCount := 0
 	errGroup.Go(func() error {
-		for i := 0; i < len(h.urls); i++ {
+		for i := 0; i < len(h.specs); i++ {
 			select {
 			case <-ctx.Done():
 				return nil
-			case res := <-respCh:
-				responses = append(responses, res)
+			case res := <-resultCh:
+				fetched[res.idx] = true
+				fetchedCount++
+				emit(res.idx, res.resp)
 			}
 		}
 		cancel()
@@ -113,76 +351,297 @@ func (h *HttpFetcher) Fetch(ctx context.Context) ([]models.Response, error) {
 	err := errGroup.Wait()
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
-			log.Printf(utils.WithRid("Fetch was cancelled", h.rid))
-			return nil, err
+			h.log.Info("Fetch was cancelled", "duration", time.Since(started))
+			return err
 		}
-		log.Printf(utils.WithRid("Fetch finished with error", h.rid))
-		return nil, err
+		h.log.Warn("Fetch finished with error", "duration", time.Since(started), "error", err)
+		return err
 	}
-	log.Printf(utils.WithRid("Fetch finished succesfully", h.rid))
-	return responses, nil
+
+	if fetchedCount < len(h.specs) {
+		if h.failFast {
+			h.log.Info("Fetch was cancelled", "duration", time.Since(started), "error", fetchCtx.Err())
+			return fetchCtx.Err()
+		}
+		//urls which were not fetched in time are reported as failed
+		for idx, spec := range h.specs {
+			if !fetched[idx] {
+				emit(idx, failedResponse(spec.Url, fetchCtx.Err()))
+			}
+		}
+	}
+	h.log.Info("Fetch finished", "urls", len(h.specs), "fetched", fetchedCount, "duration", time.Since(started))
+	return nil
 
 }
 
-//fetches single url with the given http client
-func (h *HttpFetcher) fetchUrl(ctx context.Context, client *http.Client, url string) (*models.Response, error) {
-	log.Printf("Fetching %s...", utils.WithRid(url, h.rid))
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+//fetches single url with the given http client, the attempt is limited by the timeout of the url
+//or the fetch-wide one. Returns the response with the raw body, which is limited only by the per-url limit,
+//so it may be shared with other fetches, see applyBody
+func (h *HttpFetcher) fetchUrl(ctx context.Context, client *http.Client, spec models.UrlSpec) (*models.Response, []byte, error) {
+	timeout := h.requestTimeout
+	if spec.TimeoutMs > 0 {
+		timeout = time.Duration(spec.TimeoutMs) * time.Millisecond
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	method := spec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	//fresh cached response is served without upstream request, stale one is revalidated
+	cacheable := h.cache != nil && cache.Cacheable(method, spec.Headers, spec.Body)
+	var cached *cache.Entry
+	if cacheable {
+		if entry, ok := h.cache.Lookup(method, spec.Url, spec.Headers); ok {
+			if !h.noCache && entry.Fresh(time.Now()) {
+				response, cachedBody := cachedResponse(entry, nil)
+				return response, cachedBody, nil
+			}
+			if entry.Revalidatable() {
+				cached = entry
+			}
+		}
+	}
+	trace := newRequestTrace()
+	ctx = httptrace.WithClientTrace(ctx, trace.clientTrace())
+	var body io.Reader
+	if spec.Body != "" {
+		body = strings.NewReader(spec.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, spec.Url, body)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if h.rid != "" {
+		req.Header.Set(RequestIdHeader, h.rid)
+	}
+	for name, value := range spec.Headers {
+		req.Header.Set(name, value)
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
 	}
 	resp, err := client.Do(req)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer func() { _ = resp.Body.Close() }()
-	body, err := ioutil.ReadAll(resp.Body)
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		response, cachedBody := cachedResponse(h.cache.Revalidated(cached, resp.Header), trace.timing(time.Now()))
+		return response, cachedBody, nil
+	}
+	limited := newLimitedReader(resp.Body, h.readLimit(), nil)
+	respBody, err := ioutil.ReadAll(limited)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return &models.Response{
-			Url:      url,
-			Response: string(body),
-		},
-		nil
+	timing := trace.timing(time.Now())
+
+	contentLength := resp.ContentLength
+	if contentLength < 0 {
+		contentLength = int64(len(respBody))
+	}
+
+	response := &models.Response{
+		Url:           spec.Url,
+		Status:        models.StatusOk,
+		StatusCode:    resp.StatusCode,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: contentLength,
+		Headers:       selectHeaders(resp.Header, h.responseHeaders),
+		Timing:        timing,
+		Truncated:     limited.truncated,
+	}
+	if cacheable {
+		h.cache.Store(method, spec.Url, spec.Headers, resp.Header, *response, respBody)
+	}
+	return response, respBody, nil
+}
+
+//max body size to read from upstream: the per-url limit, or the limit of the whole fetch if there is none
+func (h *HttpFetcher) readLimit() int64 {
+	if h.maxBytes > 0 {
+		return h.maxBytes
+	}
+	return h.maxBatchBytes
 }
 
-//worker, that concurrently fetches any url, received from urlCh and moves the results into resultCh
+//puts the raw body into the response within the size limits of this fetch: the per-url one and the budget
+//of the whole fetch. The body is encoded with settings of this fetch, as it might be fetched by another one
+func (h *HttpFetcher) applyBody(resp *models.Response, body []byte) error {
+	limited := newLimitedReader(bytes.NewReader(body), h.maxBytes, h.batchBudget)
+	body, _ = ioutil.ReadAll(limited)
+	truncated := resp.Truncated || limited.truncated
+	if truncated && h.failOnTruncate {
+		return ErrResponseTooLarge
+	}
+	resp.Truncated = truncated
+	encodeBody(resp, body, truncated, h.decodeJson)
+	return nil
+}
+
+//builds a response with the raw body from the cache entry, timing is nil if there was no upstream request
+func cachedResponse(entry *cache.Entry, timing *models.Timing) (*models.Response, []byte) {
+	response := entry.Response
+	response.CacheHit = true
+	response.Timing = timing
+	return &response, entry.Body
+}
+
+//picks the listed headers, which are present in the header
+func selectHeaders(header http.Header, names []string) map[string]string {
+	var selected map[string]string
+	for _, name := range names {
+		if value := header.Get(name); value != "" {
+			if selected == nil {
+				selected = make(map[string]string, len(names))
+			}
+			selected[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	return selected
+}
+
+//builds a response for the url, which failed with err
+func failedResponse(url string, err error) models.Response {
+	status := models.StatusError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		status = models.StatusCancelled
+	case errors.Is(err, transport.ErrBlocked),
+		errors.Is(err, policy.ErrDenied):
+		status = models.StatusBlocked
+	case errors.Is(err, context.DeadlineExceeded):
+		status = models.StatusTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		status = models.StatusTimeout
+	}
+	return models.Response{
+		Url:    url,
+		Status: status,
+		Error:  err.Error(),
+	}
+}
+
+//result of a single url fetch
+type fetchResult struct {
+	idx  int //index of the url in HttpFetcher.specs
+	resp models.Response
+}
+
+//worker, that concurrently fetches urls by indices, received from idxCh and moves the results into resultCh
 //can be cancelled with the ctx
 func (h *HttpFetcher) fetchUrlWorker(
 	ctx context.Context,
-	urlCh chan string,
-	resultCh chan models.Response,
-	requestTimeout time.Duration,
+	idxCh chan int,
+	resultCh chan fetchResult,
 ) error {
-	//validate
-	if requestTimeout < 0 {
-		requestTimeout = 0
-	}
-
+	//timeouts are applied by fetchUrl to every attempt, so urls may have their own ones
 	client := http.Client{
-		Transport: http.DefaultTransport,
-		Timeout:   requestTimeout,
+		Transport:     h.transport,
+		CheckRedirect: h.checkRedirect,
+	}
+	if h.observer != nil {
+		h.observer.WorkerStarted()
+		defer h.observer.WorkerStopped()
 	}
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case url := <-urlCh:
+		case idx := <-idxCh:
 			{
-				resp, err := h.fetchUrl(ctx, &client, url)
+				spec := h.specs[idx]
+				started := time.Now()
+				var resp *models.Response
+				var attempts int
+				var coalesced bool
+				err := h.checkPolicy(spec.Url)
+				if err == nil {
+					resp, attempts, coalesced, err = h.fetchUrlShared(ctx, &client, spec)
+				}
 				if err != nil {
+					failed := failedResponse(spec.Url, err)
+					failed.Coalesced = coalesced
+					resp = &failed
+				}
+				resp.Attempts = attempts
+				duration := time.Since(started)
+				if h.observer != nil {
+					h.observer.UrlFetched(resp, duration)
+				}
+				h.logFetched(&spec, resp, duration)
+				if err != nil && h.failFast {
 					if errors.Is(err, context.Canceled) {
 						return err
 					}
-					return errors.New(fmt.Sprintf("failed to fetch '%s': %s", url, err.Error()))
+					return errors.New(fmt.Sprintf("failed to fetch '%s': %s", spec.Url, err.Error()))
+				}
+				select {
+				case <-ctx.Done():
+					return nil
+				case resultCh <- fetchResult{idx: idx, resp: *resp}:
 				}
-				resultCh <- *resp
 			}
 
 		}
 	}
 
 }
+
+//checks the url against the policy, invalid urls are reported as is
+func (h *HttpFetcher) checkPolicy(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+	return h.policy.Check(u)
+}
+
+//follows redirects, which are allowed by the policy, up to 10 like http.Client does by default
+func (h *HttpFetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if err := h.policy.Check(req.URL); err != nil {
+		return fmt.Errorf("redirect to %s: %w", req.URL.Redacted(), err)
+	}
+	return nil
+}
+
+//logs the result of a single url, failures are logged as warnings
+func (h *HttpFetcher) logFetched(spec *models.UrlSpec, resp *models.Response, duration time.Duration) {
+	level := logging.LevelDebug
+	if resp.Error != "" {
+		level = logging.LevelWarn
+	}
+	if !h.log.Enabled(level) {
+		return
+	}
+	host := ""
+	if parsed, err := url.Parse(spec.Url); err == nil {
+		host = parsed.Host
+	}
+	keyvals := []interface{}{
+		"url", spec.Url, "host", host, "method", spec.Method, "status", resp.Status, "status_code", resp.StatusCode,
+		"attempts", resp.Attempts, "cache_hit", resp.CacheHit, "coalesced", resp.Coalesced, "duration", duration,
+	}
+	if resp.Error != "" {
+		h.log.Warn("Url fetch failed", append(keyvals, "error", resp.Error)...)
+		return
+	}
+	h.log.Debug("Url fetched", keyvals...)
+}
@@ -2,11 +2,18 @@ package http_fetcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/cache"
 	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/quantum0cat/simple-http-mux/internal/policy"
+	"github.com/quantum0cat/simple-http-mux/internal/transport"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -48,8 +55,13 @@ func TestHttpFetcher_fetchUrl(t *testing.T) {
 			},
 			url: testServer.URL,
 			want: &models.Response{
-				Url:      testServer.URL,
-				Response: "Test server response",
+				Url:           testServer.URL,
+				Status:        models.StatusOk,
+				StatusCode:    http.StatusOK,
+				ContentType:   "text/plain; charset=utf-8",
+				ContentLength: int64(len(testServerResponseFormat)),
+				Encoding:      models.EncodingText,
+				Response:      "Test server response",
 			},
 			wantErr: false,
 		},
@@ -70,7 +82,10 @@ func TestHttpFetcher_fetchUrl(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			resp, err := fetcher.fetchUrl(tt.ctx, tt.client, tt.url)
+			resp, body, err := fetcher.fetchUrl(tt.ctx, tt.client, models.UrlSpec{Url: tt.url})
+			if err == nil {
+				err = fetcher.applyBody(resp, body)
+			}
 			if err != nil {
 				if tt.wantErr {
 					return
@@ -78,11 +93,23 @@ func TestHttpFetcher_fetchUrl(t *testing.T) {
 				t.Errorf("fetchUrl() error = %v", err)
 				return
 			}
-			assert.Equal(t, resp, tt.want, "responses not equal")
+			assert.NotNil(t, resp.Timing, "timing is missing")
+			assert.Greater(t, resp.Timing.Total, 0.0, "total time is not measured")
+			assert.Equal(t, tt.want, withoutVolatile(*resp), "responses not equal")
 		})
 	}
 }
 
+//clears response fields, which differ from run to run
+func withoutVolatile(resp models.Response) *models.Response {
+	resp.Timing = nil
+	delete(resp.Headers, "Date")
+	if len(resp.Headers) == 0 {
+		resp.Headers = nil
+	}
+	return &resp
+}
+
 const (
 	testServersCount            = 9
 	testServerResponseFormatIdx = "Test server response %d"
@@ -103,18 +130,29 @@ func TestHttpFetcher_Fetch(t *testing.T) {
 		testServers[i] = httptest.NewServer(http.HandlerFunc(generateHandlerFunc(i)))
 		urls[i] = testServers[i].URL
 		responses[i] = models.Response{
-			Url:      urls[i],
-			Response: fmt.Sprintf(testServerResponseFormatIdx, i),
+			Index:         i,
+			Url:           urls[i],
+			Status:        models.StatusOk,
+			StatusCode:    http.StatusOK,
+			ContentType:   "text/plain; charset=utf-8",
+			ContentLength: int64(len(fmt.Sprintf(testServerResponseFormatIdx, i))),
+			Attempts:      1,
+			Encoding:      models.EncodingText,
+			Response:      fmt.Sprintf(testServerResponseFormatIdx, i),
 		}
 	}
+	//duplicates share the result of the first fetch
+	urls = append(urls, urls[0])
+	duplicate := responses[0]
+	duplicate.Index = testServersCount
+	responses = append(responses, duplicate)
 
-	fetcher, err := NewHttpFetcher(
-		0,
-		urls,
-		4,
-		10*time.Second,
-		1*time.Second,
-	)
+	fetcher, err := NewHttpFetcher("0", models.NewUrlSpecs(urls), Options{
+		MaxWorkers:     4,
+		FetchTimeout:   10 * time.Second,
+		RequestTimeout: 1 * time.Second,
+		FailFast:       true,
+	})
 	assert.NoError(t, err, "failed to construct HttpFetcher")
 
 	ctxC, cancel := context.WithCancel(context.Background())
@@ -152,7 +190,9 @@ func TestHttpFetcher_Fetch(t *testing.T) {
 			resps, err := fetcher.Fetch(tt.ctx)
 			if !tt.wantError {
 				assert.NoError(t, err, "finished with error")
-				assert.ElementsMatch(t, resps, tt.want, "responses don't match")
+				for i := range resps {
+					assert.Equal(t, &tt.want[i], withoutVolatile(resps[i]), "responses don't match")
+				}
 			}
 
 		})
@@ -162,32 +202,45 @@ func TestHttpFetcher_Fetch(t *testing.T) {
 func TestNewHttpFetcher(t *testing.T) {
 
 	tests := []struct {
-		name           string
-		rid            uint32
-		urls           []string
-		maxWorkers     int
-		fetchTimeout   time.Duration
-		requestTimeout time.Duration
-		want           *HttpFetcher
-		wantErr        bool
+		name        string
+		rid         string
+		urls        []string
+		opts        Options
+		want        *HttpFetcher
+		wantInvalid []int //indices of invalid urls
+		wantErr     bool
 	}{
 		{
-			name:           "default",
-			rid:            0,
-			urls:           []string{"url1", "url2"},
-			maxWorkers:     1,
-			fetchTimeout:   1,
-			requestTimeout: 1,
-			wantErr:        false,
+			name: "default",
+			rid:  "0",
+			urls: []string{"http://url1", "http://url2"},
+			opts: Options{
+				MaxWorkers:     1,
+				FetchTimeout:   1,
+				RequestTimeout: 1,
+			},
+			wantErr: false,
+		},
+		{
+			name: "failing",
+			rid:  "0",
+			urls: []string{},
+			opts: Options{
+				MaxWorkers:     1,
+				FetchTimeout:   1,
+				RequestTimeout: 1,
+			},
+			wantErr: true,
 		},
 		{
-			name:           "failing",
-			rid:            0,
-			urls:           []string{},
-			maxWorkers:     1,
-			fetchTimeout:   1,
-			requestTimeout: 1,
-			wantErr:        true,
+			name: "invalid urls",
+			rid:  "0",
+			urls: []string{"url1", "http://url2", "http://[::1"},
+			opts: Options{
+				MaxWorkers: 1,
+			},
+			wantInvalid: []int{0, 2},
+			wantErr:     true,
 		},
 	}
 	for _, tt := range tests {
@@ -195,14 +248,443 @@ func TestNewHttpFetcher(t *testing.T) {
 
 			_, err := NewHttpFetcher(
 				tt.rid,
-				tt.urls,
-				tt.maxWorkers,
-				tt.fetchTimeout,
-				tt.requestTimeout,
+				models.NewUrlSpecs(tt.urls),
+				tt.opts,
 			)
 			if !tt.wantErr {
 				assert.NoError(t, err, "constructor returned error")
+				return
+			}
+			assert.Error(t, err, "expected an error")
+			if tt.wantInvalid != nil {
+				var invalid *InvalidUrlsError
+				if assert.True(t, errors.As(err, &invalid), "expected InvalidUrlsError, got %v", err) {
+					indices := make([]int, len(invalid.Urls))
+					for i, url := range invalid.Urls {
+						indices[i] = url.Index
+						assert.NotEmpty(t, url.Reason, "reason is missing")
+					}
+					assert.Equal(t, tt.wantInvalid, indices, "invalid urls don't match")
+				}
 			}
 		})
 	}
 }
+
+func TestHttpFetcher_FetchPartial(t *testing.T) {
+
+	okServer := httptest.NewServer(http.HandlerFunc(generateHandlerFunc(0)))
+	slowServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(1500 * time.Millisecond)
+			_, _ = fmt.Fprintf(w, testServerResponseFormat)
+		},
+	))
+	urls := []string{okServer.URL, slowServer.URL, "http://127.0.0.1:1"}
+
+	tests := []struct {
+		name      string
+		failFast  bool
+		want      map[string]string
+		wantError bool
+	}{
+		{
+			name:     "partial results",
+			failFast: false,
+			want: map[string]string{
+				okServer.URL:         models.StatusOk,
+				slowServer.URL:       models.StatusTimeout,
+				"http://127.0.0.1:1": models.StatusError,
+			},
+		},
+		{
+			name:      "fail fast",
+			failFast:  true,
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher, err := NewHttpFetcher("0", models.NewUrlSpecs(urls), Options{
+				MaxWorkers:     4,
+				FetchTimeout:   10 * time.Second,
+				RequestTimeout: 1 * time.Second,
+				FailFast:       tt.failFast,
+			})
+			assert.NoError(t, err, "failed to construct HttpFetcher")
+
+			resps, err := fetcher.Fetch(context.Background())
+			if tt.wantError {
+				assert.Error(t, err, "expected fetch to fail")
+				return
+			}
+			assert.NoError(t, err, "finished with error")
+			assert.Len(t, resps, len(urls), "one response per url expected")
+			for i, resp := range resps {
+				assert.Equal(t, i, resp.Index, "responses order doesn't match")
+				assert.Equal(t, tt.want[resp.Url], resp.Status, "statuses don't match for %s", resp.Url)
+			}
+		})
+	}
+}
+
+func TestHttpFetcher_FetchWithOptions(t *testing.T) {
+
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			_, _ = fmt.Fprintf(w, "%s %s %s %s", r.Method, r.Header.Get("X-Test"), r.Header.Get(RequestIdHeader), string(body))
+		},
+	))
+
+	fetcher, err := NewHttpFetcher("rid-1", models.NewUrlSpecs([]string{testServer.URL}), Options{
+		MaxWorkers:     1,
+		RequestTimeout: 1 * time.Second,
+		Method:         http.MethodPost,
+		Headers:        map[string]string{"X-Test": "header"},
+		Body:           "body",
+	})
+	assert.NoError(t, err, "failed to construct HttpFetcher")
+
+	resps, err := fetcher.Fetch(context.Background())
+	assert.NoError(t, err, "finished with error")
+	assert.Len(t, resps, 1, "one response expected")
+	assert.Equal(t, "POST header rid-1 body", resps[0].Response, "request options were not applied")
+}
+
+func TestHttpFetcher_FetchSpecs(t *testing.T) {
+
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			_, _ = fmt.Fprintf(w, "%s %s", r.Method, string(body))
+		},
+	))
+
+	specs := []models.UrlSpec{
+		{Url: testServer.URL, Method: http.MethodPost, Body: "post", Id: []byte(`"first"`)},
+		{Url: testServer.URL, Method: http.MethodPut, Body: "put", Id: []byte(`2`)},
+		{Url: testServer.URL},
+		{Url: testServer.URL, Id: []byte(`"duplicate"`)},
+	}
+	fetcher, err := NewHttpFetcher("0", specs, Options{MaxWorkers: 4, RequestTimeout: 1 * time.Second})
+	assert.NoError(t, err, "failed to construct HttpFetcher")
+
+	resps, err := fetcher.Fetch(context.Background())
+	assert.NoError(t, err, "finished with error")
+	assert.Len(t, resps, len(specs), "one response per url expected")
+
+	want := []struct {
+		response string
+		id       string
+	}{
+		{"POST post", `"first"`},
+		{"PUT put", `2`},
+		{"GET ", ``},
+		{"GET ", `"duplicate"`},
+	}
+	for i, w := range want {
+		assert.Equal(t, w.response, resps[i].Response, "responses don't match")
+		assert.Equal(t, w.id, string(resps[i].Id), "ids don't match")
+	}
+}
+
+func TestHttpFetcher_FetchTimeouts(t *testing.T) {
+
+	slowServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(300 * time.Millisecond)
+			_, _ = fmt.Fprintf(w, testServerResponseFormat)
+		},
+	))
+
+	specs := []models.UrlSpec{
+		{Url: slowServer.URL},
+		{Url: slowServer.URL + "/long", TimeoutMs: 2000},
+		{Url: slowServer.URL + "/short", TimeoutMs: 50},
+	}
+	fetcher, err := NewHttpFetcher("0", specs, Options{MaxWorkers: 3, RequestTimeout: 100 * time.Millisecond})
+	assert.NoError(t, err, "failed to construct HttpFetcher")
+
+	resps, err := fetcher.Fetch(context.Background())
+	assert.NoError(t, err, "finished with error")
+	assert.Len(t, resps, len(specs), "one response per url expected")
+	//timeouts of urls take precedence over the fetch-wide one, either longer or shorter
+	assert.Equal(t, models.StatusTimeout, resps[0].Status, "fetch-wide timeout is not applied")
+	assert.Equal(t, models.StatusOk, resps[1].Status, "longer url timeout is not applied")
+	assert.Equal(t, models.StatusTimeout, resps[2].Status, "shorter url timeout is not applied")
+}
+
+func TestHttpFetcher_FetchLimits(t *testing.T) {
+
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, testServerResponseFormat)
+		},
+	))
+
+	tests := []struct {
+		name           string
+		opts           Options
+		wantStatus     string
+		wantResponse   string
+		wantTruncated  bool
+		wantErrMessage string
+	}{
+		{
+			name:          "truncated",
+			opts:          Options{MaxWorkers: 1, MaxResponseBytes: 4},
+			wantStatus:    models.StatusOk,
+			wantResponse:  testServerResponseFormat[:4],
+			wantTruncated: true,
+		},
+		{
+			name:           "fail on truncate",
+			opts:           Options{MaxWorkers: 1, MaxResponseBytes: 4, FailOnTruncate: true},
+			wantStatus:     models.StatusError,
+			wantErrMessage: ErrResponseTooLarge.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher, err := NewHttpFetcher("0", models.NewUrlSpecs([]string{testServer.URL}), tt.opts)
+			assert.NoError(t, err, "failed to construct HttpFetcher")
+
+			resps, err := fetcher.Fetch(context.Background())
+			assert.NoError(t, err, "finished with error")
+			assert.Equal(t, tt.wantStatus, resps[0].Status, "statuses don't match")
+			assert.Equal(t, tt.wantResponse, resps[0].Response, "responses don't match")
+			assert.Equal(t, tt.wantTruncated, resps[0].Truncated, "truncation doesn't match")
+			assert.Equal(t, tt.wantErrMessage, resps[0].Error, "errors don't match")
+		})
+	}
+}
+
+func TestHttpFetcher_FetchCache(t *testing.T) {
+
+	var requests, revalidations int32
+	etag := `"v1"`
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				atomic.AddInt32(&revalidations, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			_, _ = fmt.Fprintf(w, "body %s", etag)
+		},
+	))
+	responsesCache := cache.New(cache.Config{MaxBytes: 1 << 20})
+
+	tests := []struct {
+		name              string
+		noCache           bool
+		etag              string
+		wantCacheHit      bool
+		wantResponse      string
+		wantRequests      int32
+		wantRevalidations int32
+	}{
+		{name: "miss", wantResponse: `body "v1"`, wantRequests: 1},
+		{name: "hit", wantCacheHit: true, wantResponse: `body "v1"`, wantRequests: 1},
+		{name: "revalidated", noCache: true, wantCacheHit: true, wantResponse: `body "v1"`, wantRequests: 2, wantRevalidations: 1},
+		{name: "modified", noCache: true, etag: `"v2"`, wantResponse: `body "v2"`, wantRequests: 3, wantRevalidations: 1},
+		{name: "hit modified", wantCacheHit: true, wantResponse: `body "v2"`, wantRequests: 3, wantRevalidations: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.etag != "" {
+				etag = tt.etag
+			}
+			opts := Options{MaxWorkers: 1, Cache: responsesCache, NoCache: tt.noCache}
+			fetcher, err := NewHttpFetcher("0", models.NewUrlSpecs([]string{testServer.URL}), opts)
+			assert.NoError(t, err, "failed to construct HttpFetcher")
+
+			resps, err := fetcher.Fetch(context.Background())
+			assert.NoError(t, err, "finished with error")
+			assert.Equal(t, tt.wantCacheHit, resps[0].CacheHit, "cache hits don't match")
+			assert.Equal(t, tt.wantResponse, resps[0].Response, "responses don't match")
+			assert.Equal(t, tt.wantRequests, atomic.LoadInt32(&requests), "upstream requests count doesn't match")
+			assert.Equal(t, tt.wantRevalidations, atomic.LoadInt32(&revalidations), "revalidations count doesn't match")
+		})
+	}
+}
+
+func TestHttpFetcher_FetchCacheEncoding(t *testing.T) {
+
+	var requests int32
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"a":1}`)
+		},
+	))
+	responsesCache := cache.New(cache.Config{MaxBytes: 1 << 20})
+
+	//cached body is encoded with settings of every fetch, not of the one, which stored it
+	tests := []struct {
+		name         string
+		decodeJson   bool
+		wantCacheHit bool
+		wantEncoding string
+		wantResponse string
+		wantJson     string
+	}{
+		{name: "decoded miss", decodeJson: true, wantEncoding: models.EncodingJson, wantJson: `{"a":1}`},
+		{name: "text hit", wantCacheHit: true, wantEncoding: models.EncodingText, wantResponse: `{"a":1}`},
+		{name: "decoded hit", decodeJson: true, wantCacheHit: true, wantEncoding: models.EncodingJson, wantJson: `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{MaxWorkers: 1, Cache: responsesCache, DecodeJson: tt.decodeJson}
+			fetcher, err := NewHttpFetcher("0", models.NewUrlSpecs([]string{testServer.URL}), opts)
+			assert.NoError(t, err, "failed to construct HttpFetcher")
+
+			resps, err := fetcher.Fetch(context.Background())
+			assert.NoError(t, err, "finished with error")
+			assert.Equal(t, tt.wantCacheHit, resps[0].CacheHit, "cache hits don't match")
+			assert.Equal(t, tt.wantEncoding, resps[0].Encoding, "encodings don't match")
+			assert.Equal(t, tt.wantResponse, resps[0].Response, "responses don't match")
+			assert.Equal(t, tt.wantJson, string(resps[0].Json), "json responses don't match")
+		})
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "upstream requests count doesn't match")
+}
+
+func TestHttpFetcher_FetchCacheLimits(t *testing.T) {
+
+	var requests int32
+	body := strings.Repeat("a", 1000)
+	testServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = fmt.Fprint(w, body)
+		},
+	))
+	responsesCache := cache.New(cache.Config{MaxBytes: 1 << 20})
+	urls := []string{testServer.URL + "/a", testServer.URL + "/b"}
+
+	//cached bodies are limited by settings of every fetch, not of the one, which stored them
+	tests := []struct {
+		name           string
+		opts           Options
+		wantStatus     []string
+		wantLengths    []int
+		wantTruncated  []bool
+		wantErrMessage string
+	}{
+		{
+			name:          "miss",
+			wantStatus:    []string{models.StatusOk, models.StatusOk},
+			wantLengths:   []int{1000, 1000},
+			wantTruncated: []bool{false, false},
+		},
+		{
+			name:          "url limit",
+			opts:          Options{MaxResponseBytes: 10},
+			wantStatus:    []string{models.StatusOk, models.StatusOk},
+			wantLengths:   []int{10, 10},
+			wantTruncated: []bool{true, true},
+		},
+		{
+			name:           "url limit without truncation",
+			opts:           Options{MaxResponseBytes: 10, FailOnTruncate: true},
+			wantStatus:     []string{models.StatusError, models.StatusError},
+			wantLengths:    []int{0, 0},
+			wantTruncated:  []bool{false, false},
+			wantErrMessage: ErrResponseTooLarge.Error(),
+		},
+		{
+			name:          "batch limit",
+			opts:          Options{MaxBatchResponseBytes: 1500},
+			wantStatus:    []string{models.StatusOk, models.StatusOk},
+			wantLengths:   []int{1000, 500},
+			wantTruncated: []bool{false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.MaxWorkers = 1
+			opts.Cache = responsesCache
+			fetcher, err := NewHttpFetcher("0", models.NewUrlSpecs(urls), opts)
+			assert.NoError(t, err, "failed to construct HttpFetcher")
+
+			resps, err := fetcher.Fetch(context.Background())
+			assert.NoError(t, err, "finished with error")
+			for i, resp := range resps {
+				assert.Equal(t, tt.wantStatus[i], resp.Status, "statuses don't match")
+				assert.Len(t, resp.Response, tt.wantLengths[i], "body lengths don't match")
+				assert.Equal(t, tt.wantTruncated[i], resp.Truncated, "truncation doesn't match")
+				if tt.wantErrMessage != "" {
+					assert.Equal(t, tt.wantErrMessage, resp.Error, "errors don't match")
+				}
+			}
+		})
+	}
+	assert.Equal(t, int32(len(urls)), atomic.LoadInt32(&requests), "upstream requests count doesn't match")
+}
+
+func TestHttpFetcher_FetchBlocked(t *testing.T) {
+
+	testServer := httptest.NewServer(http.HandlerFunc(generateHandlerFunc(0)))
+	defer testServer.Close()
+
+	fetcher, err := NewHttpFetcher("0", models.NewUrlSpecs([]string{testServer.URL}), Options{
+		MaxWorkers: 1,
+		Transport:  transport.New(transport.Config{BlockPrivateNetworks: true}),
+		Retry:      RetryPolicy{MaxAttempts: 3, RetryErrors: ErrorClasses},
+	})
+	assert.NoError(t, err, "failed to construct HttpFetcher")
+
+	resps, err := fetcher.Fetch(context.Background())
+	assert.NoError(t, err, "finished with error")
+	assert.Equal(t, models.StatusBlocked, resps[0].Status, "statuses don't match")
+	assert.Equal(t, 1, resps[0].Attempts, "blocked urls must not be retried")
+}
+
+func TestHttpFetcher_FetchPolicy(t *testing.T) {
+
+	okServer := httptest.NewServer(http.HandlerFunc(generateHandlerFunc(0)))
+	defer okServer.Close()
+	redirectServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://localhost"+strings.TrimPrefix(okServer.URL, "http://127.0.0.1"), http.StatusFound)
+		},
+	))
+	defer redirectServer.Close()
+
+	tests := []struct {
+		name       string
+		policy     policy.Policy
+		url        string
+		wantStatus string
+	}{
+		{name: "allowed", url: okServer.URL, wantStatus: models.StatusOk},
+		{name: "scheme", url: "gopher://127.0.0.1/", wantStatus: models.StatusBlocked},
+		{name: "denied host", policy: policy.Policy{DenyHosts: []string{"127.0.0.*"}}, url: okServer.URL, wantStatus: models.StatusBlocked},
+		{name: "redirect allowed", url: redirectServer.URL, wantStatus: models.StatusOk},
+		{
+			name:       "redirect to denied host",
+			policy:     policy.Policy{AllowHosts: []string{"127.0.0.1"}},
+			url:        redirectServer.URL,
+			wantStatus: models.StatusBlocked,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher, err := NewHttpFetcher("0", models.NewUrlSpecs([]string{tt.url}), Options{MaxWorkers: 1, Policy: tt.policy})
+			assert.NoError(t, err, "failed to construct HttpFetcher")
+
+			resps, err := fetcher.Fetch(context.Background())
+			assert.NoError(t, err, "policy errors must not fail the fetch")
+			assert.Equal(t, tt.wantStatus, resps[0].Status, "statuses don't match: %s", resps[0].Error)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package http_fetcher
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// ErrResponseTooLarge
+//is returned for urls, which response body exceeds the limits, if truncation is not allowed
+var ErrResponseTooLarge = errors.New("response body exceeds the size limit")
+
+//reader, which stops at the per-url limit or when the shared budget of the whole fetch is spent.
+//Reaching a limit looks like EOF for the caller, truncated reports if some data was left unread.
+type limitedReader struct {
+	r         io.Reader
+	left      int64  //bytes left for this url, negative -> no limit
+	budget    *int64 //bytes left for the whole fetch, shared between workers, nil -> no limit
+	truncated bool
+}
+
+func newLimitedReader(r io.Reader, limit int64, budget *int64) *limitedReader {
+	if limit <= 0 {
+		limit = -1
+	}
+	return &limitedReader{
+		r:      r,
+		left:   limit,
+		budget: budget,
+	}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	want := int64(len(p))
+	if l.left >= 0 && want > l.left {
+		want = l.left
+	}
+	granted := l.reserve(want)
+	if granted == 0 && len(p) > 0 {
+		//nothing more is allowed, check if the body has more data
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			l.truncated = true
+			return 0, io.EOF
+		}
+		return 0, err
+	}
+
+	n, err := l.r.Read(p[:granted])
+	l.release(granted - int64(n))
+	if l.left >= 0 {
+		l.left -= int64(n)
+	}
+	return n, err
+}
+
+//takes up to n bytes from the shared budget, returns the taken count
+func (l *limitedReader) reserve(n int64) int64 {
+	if l.budget == nil {
+		return n
+	}
+	for {
+		left := atomic.LoadInt64(l.budget)
+		taken := n
+		if taken > left {
+			taken = left
+		}
+		if taken <= 0 {
+			return 0
+		}
+		if atomic.CompareAndSwapInt64(l.budget, left, left-taken) {
+			return taken
+		}
+	}
+}
+
+//returns unused bytes into the shared budget
+func (l *limitedReader) release(n int64) {
+	if l.budget != nil && n > 0 {
+		atomic.AddInt64(l.budget, n)
+	}
+}
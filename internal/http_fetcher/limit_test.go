@@ -0,0 +1,75 @@
+package http_fetcher
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func Test_limitedReader(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		body          string
+		limit         int64
+		budget        int64 //negative -> no budget
+		want          string
+		wantTruncated bool
+		wantBudget    int64
+	}{
+		{
+			name:   "no limits",
+			body:   "0123456789",
+			budget: -1,
+			want:   "0123456789",
+		},
+		{
+			name:   "exactly at limit",
+			body:   "0123456789",
+			limit:  10,
+			budget: -1,
+			want:   "0123456789",
+		},
+		{
+			name:          "per url limit",
+			body:          "0123456789",
+			limit:         4,
+			budget:        -1,
+			want:          "0123",
+			wantTruncated: true,
+		},
+		{
+			name:          "batch budget",
+			body:          "0123456789",
+			limit:         8,
+			budget:        6,
+			want:          "012345",
+			wantTruncated: true,
+			wantBudget:    0,
+		},
+		{
+			name:       "budget left",
+			body:       "0123",
+			budget:     6,
+			want:       "0123",
+			wantBudget: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var budget *int64
+			if tt.budget >= 0 {
+				budget = &tt.budget
+			}
+			reader := newLimitedReader(strings.NewReader(tt.body), tt.limit, budget)
+			data, err := ioutil.ReadAll(reader)
+			assert.NoError(t, err, "failed to read")
+			assert.Equal(t, tt.want, string(data), "data doesn't match")
+			assert.Equal(t, tt.wantTruncated, reader.truncated, "truncation doesn't match")
+			if budget != nil {
+				assert.Equal(t, tt.wantBudget, *budget, "budget left doesn't match")
+			}
+		})
+	}
+}
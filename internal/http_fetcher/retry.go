@@ -0,0 +1,167 @@
+package http_fetcher
+
+import (
+	"context"
+	"errors"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/quantum0cat/simple-http-mux/internal/policy"
+	"github.com/quantum0cat/simple-http-mux/internal/transport"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// classes of errors, which may be retried
+const (
+	ErrorClassTimeout    = "timeout"    //request or connection timeout
+	ErrorClassConnection = "connection" //connection refused, reset or closed unexpectedly
+	ErrorClassDns        = "dns"        //host name resolution failure
+)
+
+// ErrorClasses
+//all error classes, which may be retried
+var ErrorClasses = []string{ErrorClassTimeout, ErrorClassConnection, ErrorClassDns}
+
+// RetryPolicy
+//describes how failed urls are retried, zero value means no retries.
+//Retries never exceed the fetch timeout: if the next attempt can't start before it, the last result is reported.
+type RetryPolicy struct {
+	MaxAttempts   int           //attempts count including the first one, <= 1 -> no retries
+	BackoffBase   time.Duration //delay before the first retry, doubled for every next one
+	BackoffCap    time.Duration //max delay between attempts, 0 -> no limit
+	Jitter        float64       //random deviation of the delay in [0, 1], e.g. 0.2 -> delay*[0.8, 1.2]
+	RetryStatuses []int         //upstream statuses to retry, e.g. 503
+	RetryErrors   []string      //error classes to retry, ErrorClass* constants
+}
+
+//fetches the url like fetchUrl, retrying it according to the policy, also returns the attempts count.
+//Only idempotent methods are retried, so writes like POST are never repeated upstream
+func (h *HttpFetcher) fetchUrlWithRetries(
+	ctx context.Context,
+	client *http.Client,
+	spec models.UrlSpec,
+) (*models.Response, []byte, int, error) {
+	maxAttempts := h.retry.MaxAttempts
+	if !retriesMethod(spec.Method) {
+		maxAttempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		resp, body, err := h.fetchUrl(ctx, client, spec)
+		if attempt >= maxAttempts || ctx.Err() != nil {
+			return resp, body, attempt, err
+		}
+
+		var delay time.Duration
+		switch {
+		case err != nil && h.retry.retriesError(err):
+			delay = h.retry.backoff(attempt)
+		case err == nil && h.retry.retriesStatus(resp.StatusCode):
+			delay = h.retry.backoff(attempt)
+			if retryAfter, ok := parseRetryAfter(resp.Headers["Retry-After"], time.Now()); ok && retryAfter > delay {
+				delay = retryAfter
+			}
+		default:
+			return resp, body, attempt, err
+		}
+
+		//don't start an attempt, which can't finish in time
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return resp, body, attempt, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, body, attempt, err
+		case <-timer.C:
+		}
+	}
+}
+
+//tells whether the method may be retried, i.e. it's idempotent, empty method is GET
+func retriesMethod(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+//delay before the next attempt after the given one
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BackoffBase
+	for i := 1; i < attempt && (p.BackoffCap <= 0 || delay < p.BackoffCap); i++ {
+		delay *= 2
+	}
+	if p.Jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 - p.Jitter + 2*p.Jitter*rand.Float64()))
+	}
+	if p.BackoffCap > 0 && delay > p.BackoffCap {
+		delay = p.BackoffCap
+	}
+	return delay
+}
+
+func (p *RetryPolicy) retriesStatus(statusCode int) bool {
+	for _, status := range p.RetryStatuses {
+		if status == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) retriesError(err error) bool {
+	class := errorClass(err)
+	for _, retried := range p.RetryErrors {
+		if retried == class {
+			return true
+		}
+	}
+	return false
+}
+
+//classifies the error of a single attempt, returns empty string for errors, which are never retried
+func errorClass(err error) string {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, transport.ErrBlocked),
+		errors.Is(err, policy.ErrDenied):
+		return ""
+	case errors.As(err, &dnsErr):
+		return ErrorClassDns
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	case errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorClassConnection
+	}
+	return ""
+}
+
+//parses Retry-After header, which is either delay in seconds or HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,158 @@
+package http_fetcher
+
+import (
+	"context"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//returns a server, which responds with failStatus for the first failures requests
+func failingServer(failures int32, failStatus int, retryAfter string) *httptest.Server {
+	var requests int32
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) <= failures {
+				if retryAfter != "" {
+					w.Header().Set("Retry-After", retryAfter)
+				}
+				w.WriteHeader(failStatus)
+				return
+			}
+			_, _ = w.Write([]byte(testServerResponseFormat))
+		},
+	))
+}
+
+func TestHttpFetcher_FetchRetries(t *testing.T) {
+
+	retry := RetryPolicy{
+		MaxAttempts:   3,
+		BackoffBase:   10 * time.Millisecond,
+		BackoffCap:    50 * time.Millisecond,
+		Jitter:        0.2,
+		RetryStatuses: []int{http.StatusServiceUnavailable},
+		RetryErrors:   []string{ErrorClassConnection},
+	}
+
+	tests := []struct {
+		name           string
+		server         *httptest.Server
+		retry          RetryPolicy
+		method         string
+		fetchTimeout   time.Duration
+		wantStatusCode int
+		wantAttempts   int
+	}{
+		{
+			name:           "recovered",
+			server:         failingServer(2, http.StatusServiceUnavailable, ""),
+			retry:          retry,
+			wantStatusCode: http.StatusOK,
+			wantAttempts:   3,
+		},
+		{
+			name:           "attempts exhausted",
+			server:         failingServer(5, http.StatusServiceUnavailable, ""),
+			retry:          retry,
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantAttempts:   3,
+		},
+		{
+			name:           "status is not retried",
+			server:         failingServer(1, http.StatusInternalServerError, ""),
+			retry:          retry,
+			wantStatusCode: http.StatusInternalServerError,
+			wantAttempts:   1,
+		},
+		{
+			name:           "idempotent method is retried",
+			server:         failingServer(2, http.StatusServiceUnavailable, ""),
+			retry:          retry,
+			method:         http.MethodPut,
+			wantStatusCode: http.StatusOK,
+			wantAttempts:   3,
+		},
+		{
+			name:           "non-idempotent method is not retried",
+			server:         failingServer(2, http.StatusServiceUnavailable, ""),
+			retry:          retry,
+			method:         http.MethodPost,
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantAttempts:   1,
+		},
+		{
+			name:           "no retries by default",
+			server:         failingServer(1, http.StatusServiceUnavailable, ""),
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantAttempts:   1,
+		},
+		{
+			name:           "retry after exceeds fetch timeout",
+			server:         failingServer(1, http.StatusServiceUnavailable, "10"),
+			retry:          retry,
+			fetchTimeout:   1 * time.Second,
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantAttempts:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher, err := NewHttpFetcher("0", models.NewUrlSpecs([]string{tt.server.URL}), Options{
+				MaxWorkers:   1,
+				Method:       tt.method,
+				FetchTimeout: tt.fetchTimeout,
+				Retry:        tt.retry,
+			})
+			assert.NoError(t, err, "failed to construct HttpFetcher")
+
+			resps, err := fetcher.Fetch(context.Background())
+			assert.NoError(t, err, "finished with error")
+			assert.Equal(t, tt.wantStatusCode, resps[0].StatusCode, "statuses don't match")
+			assert.Equal(t, tt.wantAttempts, resps[0].Attempts, "attempts don't match")
+		})
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+
+	policy := RetryPolicy{BackoffBase: 100 * time.Millisecond, BackoffCap: 300 * time.Millisecond}
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(1), "first delay doesn't match")
+	assert.Equal(t, 200*time.Millisecond, policy.backoff(2), "second delay doesn't match")
+	assert.Equal(t, 300*time.Millisecond, policy.backoff(3), "capped delay doesn't match")
+	assert.Equal(t, 300*time.Millisecond, policy.backoff(100), "capped delay doesn't match")
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.backoff(1)
+		assert.True(t, delay >= 50*time.Millisecond && delay <= 150*time.Millisecond, "delay %s is out of jitter range", delay)
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "empty", value: ""},
+		{name: "seconds", value: "5", want: 5 * time.Second, wantOk: true},
+		{name: "date", value: "Sat, 01 Jan 2022 00:00:10 GMT", want: 10 * time.Second, wantOk: true},
+		{name: "past date", value: "Fri, 31 Dec 2021 00:00:00 GMT", want: 0, wantOk: true},
+		{name: "invalid", value: "soon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			assert.Equal(t, tt.wantOk, ok, "results don't match")
+			assert.Equal(t, tt.want, got, "delays don't match")
+		})
+	}
+}
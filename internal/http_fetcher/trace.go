@@ -0,0 +1,67 @@
+package http_fetcher
+
+import (
+	"crypto/tls"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+//collects timings of a single request with httptrace hooks
+type requestTrace struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	firstByte    time.Time
+}
+
+func newRequestTrace() *requestTrace {
+	return &requestTrace{start: time.Now()}
+}
+
+//returns hooks, which fill the trace, hooks may be called from transport goroutines
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	//set stores the current time into the field, if it was not set before
+	set := func(field *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if field.IsZero() {
+			*field = time.Now()
+		}
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { set(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { set(&t.dnsDone) },
+		ConnectStart:         func(string, string) { set(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { set(&t.connectDone) },
+		TLSHandshakeStart:    func() { set(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { set(&t.tlsDone) },
+		GotFirstResponseByte: func() { set(&t.firstByte) },
+	}
+}
+
+//builds the timing breakdown, phases which didn't happen (e.g. reused connection) are zero
+func (t *requestTrace) timing(end time.Time) *models.Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &models.Timing{
+		DNS:     milliseconds(t.dnsStart, t.dnsDone),
+		Connect: milliseconds(t.connectStart, t.connectDone),
+		TLS:     milliseconds(t.tlsStart, t.tlsDone),
+		TTFB:    milliseconds(t.start, t.firstByte),
+		Total:   milliseconds(t.start, end),
+	}
+}
+
+func milliseconds(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+	return float64(to.Sub(from)) / float64(time.Millisecond)
+}
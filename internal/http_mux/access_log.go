@@ -0,0 +1,157 @@
+package http_mux
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// formats of the access log
+const (
+	AccessLogCommon   = "common"   //Common Log Format
+	AccessLogCombined = "combined" //Combined Log Format, Common one with referer and user agent
+	AccessLogJSON     = "json"     //JSON object per line
+)
+
+// AccessLogFormats
+//supported formats of the access log
+var AccessLogFormats = []string{AccessLogCommon, AccessLogCombined, AccessLogJSON}
+
+//record of the access log, written when the response is finished
+type accessRecord struct {
+	Time       string  `json:"time"`
+	Remote     string  `json:"remote"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Proto      string  `json:"proto"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs float64 `json:"duration_ms"`
+	RequestId  string  `json:"request_id"`
+	Urls       int     `json:"urls"`   //urls count of the fetch request
+	Failed     int     `json:"failed"` //urls, which failed or timed out upstream
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+}
+
+//stats of a fetch, the handler fills them for the access log
+type accessStats struct {
+	urls   int
+	failed int
+}
+
+type accessStatsKey struct{}
+
+//returns stats of the request to fill, nil if the access log is disabled
+func requestStats(r *http.Request) *accessStats {
+	stats, _ := r.Context().Value(accessStatsKey{}).(*accessStats)
+	return stats
+}
+
+func (s *accessStats) setUrls(count int) {
+	if s != nil {
+		s.urls = count
+	}
+}
+
+//counts the response if it failed upstream
+func (s *accessStats) add(resp *models.Response) {
+	if s != nil && (resp.Status == models.StatusError || resp.Status == models.StatusTimeout) {
+		s.failed++
+	}
+}
+
+//counts a failure, which aborted the fetch
+func (s *accessStats) addFailure() {
+	if s != nil {
+		s.failed++
+	}
+}
+
+//writes a record per request to its own sink, apart from application logs
+type accessLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+}
+
+//records every request passed to next, the request id must be in the context already
+func (l *accessLogger) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		stats := &accessStats{}
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), accessStatsKey{}, stats)))
+
+		remote, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remote = r.RemoteAddr
+		}
+		l.write(started, &accessRecord{
+			Remote:     remote,
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Proto:      r.Proto,
+			Status:     recorder.statusCode(),
+			Bytes:      recorder.written,
+			DurationMs: float64(time.Since(started)) / float64(time.Millisecond),
+			RequestId:  requestId(r),
+			Urls:       stats.urls,
+			Failed:     stats.failed,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		})
+	})
+}
+
+func (l *accessLogger) write(started time.Time, record *accessRecord) {
+	var line []byte
+	if l.format == AccessLogJSON {
+		record.Time = started.Format(time.RFC3339Nano)
+		data, err := json.Marshal(record)
+		if err != nil {
+			return
+		}
+		line = append(data, '\n')
+	} else {
+		line = []byte(l.commonLine(started, record))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(line)
+}
+
+//formats the record in Common or Combined Log Format, followed by the fields, which the formats lack
+func (l *accessLogger) commonLine(started time.Time, record *accessRecord) string {
+	bytes := "-"
+	if record.Bytes > 0 {
+		bytes = strconv.FormatInt(record.Bytes, 10)
+	}
+	line := fmt.Sprintf("%s - - [%s] %s %d %s",
+		record.Remote,
+		started.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(record.Method+" "+record.Path+" "+record.Proto),
+		record.Status,
+		bytes,
+	)
+	if l.format == AccessLogCombined {
+		line += " " + quoteOrDash(record.Referer) + " " + quoteOrDash(record.UserAgent)
+	}
+	return line + fmt.Sprintf(" rid=%s urls=%d failed=%d duration_ms=%.3f\n",
+		record.RequestId, record.Urls, record.Failed, record.DurationMs)
+}
+
+//quotes the value, empty one is "-" by convention of the formats
+func quoteOrDash(value string) string {
+	if value == "" {
+		return `"-"`
+	}
+	return strconv.Quote(value)
+}
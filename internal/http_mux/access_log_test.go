@@ -0,0 +1,69 @@
+package http_mux
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/quantum0cat/simple-http-mux/internal/http_fetcher"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestHttpMux_accessLog(t *testing.T) {
+
+	upstream := httptest.NewServer(http.HandlerFunc(generateHandlerFunc(0)))
+	defer upstream.Close()
+	dto := models.UrlsDto{Urls: models.NewUrlSpecs([]string{upstream.URL, "http://127.0.0.1:1"})}
+
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{
+			name:   "common",
+			format: AccessLogCommon,
+			want: `^192\.0\.2\.1 - - \[[^\]]+\] "POST /v1/fetch HTTP/1\.1" 200 \d+ ` +
+				`rid=access-1 urls=2 failed=1 duration_ms=\d+\.\d{3}\n$`,
+		},
+		{
+			name:   "combined",
+			format: AccessLogCombined,
+			want: `^192\.0\.2\.1 - - \[[^\]]+\] "POST /v1/fetch HTTP/1\.1" 200 \d+ "-" "test-agent" ` +
+				`rid=access-1 urls=2 failed=1 duration_ms=\d+\.\d{3}\n$`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sink bytes.Buffer
+			mux := NewHttpMux(context.Background(), 10000, 100, Options{AccessLog: &sink, AccessLogFormat: tt.format}, nil)
+			r := httptest.NewRequest(http.MethodPost, "http://localhost"+PathFetch, bytes.NewBuffer(dto.Marshal()))
+			r.Header.Set(http_fetcher.RequestIdHeader, "access-1")
+			r.Header.Set("User-Agent", "test-agent")
+			w := httptest.NewRecorder()
+			mux.server.Handler.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code, "status codes don't match")
+			assert.Regexp(t, regexp.MustCompile(tt.want), sink.String(), "access log records don't match")
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var sink bytes.Buffer
+		mux := NewHttpMux(context.Background(), 10000, 100, Options{AccessLog: &sink, AccessLogFormat: AccessLogJSON}, nil)
+		w := httptest.NewRecorder()
+		mux.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://localhost/unknown?x=1", nil))
+
+		var record accessRecord
+		assert.NoError(t, json.Unmarshal(sink.Bytes(), &record), "failed to unmarshal access log record")
+		assert.Equal(t, http.MethodGet, record.Method, "methods don't match")
+		assert.Equal(t, "/unknown?x=1", record.Path, "paths don't match")
+		assert.Equal(t, http.StatusNotFound, record.Status, "statuses don't match")
+		assert.Equal(t, int64(w.Body.Len()), record.Bytes, "sizes don't match")
+		assert.Equal(t, w.Header().Get(http_fetcher.RequestIdHeader), record.RequestId, "request ids don't match")
+		assert.Equal(t, "192.0.2.1", record.Remote, "remote addresses don't match")
+	})
+}
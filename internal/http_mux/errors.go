@@ -0,0 +1,85 @@
+package http_mux
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// codes of API errors, clients may rely on them, see the catalogue in README
+const (
+	ErrCodeNotFound             = "not_found"
+	ErrCodeMethodNotAllowed     = "method_not_allowed"
+	ErrCodeUnsupportedMediaType = "unsupported_media_type"
+	ErrCodeEmptyBody            = "empty_body"
+	ErrCodeBodyTooLarge         = "body_too_large"
+	ErrCodeInvalidJson          = "invalid_json"
+	ErrCodeNoUrls               = "no_urls"
+	ErrCodeTooManyUrls          = "too_many_urls"
+	ErrCodeInvalidUrls          = "invalid_urls"
+	ErrCodeInvalidOptions       = "invalid_options"
+	ErrCodeCacheDisabled        = "cache_disabled"
+	ErrCodeUpstreamFailed       = "upstream_failed"
+	ErrCodeFetchTimeout         = "fetch_timeout"
+	ErrCodeClientClosedRequest  = "client_closed_request"
+	ErrCodeShuttingDown         = "shutting_down"
+	ErrCodeInternal             = "internal_error"
+)
+
+//nginx's non-standard status for requests, which the client cancelled
+const statusClientClosedRequest = 499
+
+//HTTP status of every error code
+var errorStatuses = map[string]int{
+	ErrCodeNotFound:             http.StatusNotFound,
+	ErrCodeMethodNotAllowed:     http.StatusMethodNotAllowed,
+	ErrCodeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	ErrCodeEmptyBody:            http.StatusBadRequest,
+	ErrCodeBodyTooLarge:         http.StatusRequestEntityTooLarge,
+	ErrCodeInvalidJson:          http.StatusBadRequest,
+	ErrCodeNoUrls:               http.StatusUnprocessableEntity,
+	ErrCodeTooManyUrls:          http.StatusUnprocessableEntity,
+	ErrCodeInvalidUrls:          http.StatusUnprocessableEntity,
+	ErrCodeInvalidOptions:       http.StatusUnprocessableEntity,
+	ErrCodeCacheDisabled:        http.StatusNotFound,
+	ErrCodeUpstreamFailed:       http.StatusBadGateway,
+	ErrCodeFetchTimeout:         http.StatusGatewayTimeout,
+	ErrCodeClientClosedRequest:  statusClientClosedRequest,
+	ErrCodeShuttingDown:         http.StatusServiceUnavailable,
+	ErrCodeInternal:             http.StatusInternalServerError,
+}
+
+func errorStatus(code string) int {
+	if status, ok := errorStatuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+//error code of the failed fetch: the client is gone, the server is stopping, the fetch timed out or an url failed
+func (h *muxHandler) fetchErrorCode(r *http.Request, err error) string {
+	switch {
+	case r.Context().Err() != nil:
+		return ErrCodeClientClosedRequest
+	case h.ctx.Err() != nil:
+		return ErrCodeShuttingDown
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrCodeFetchTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrCodeInternal
+	}
+	return ErrCodeUpstreamFailed
+}
+
+//context of the request processing, which is cancelled when the client is gone or the server is stopping
+func (h *muxHandler) requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+	go func() {
+		select {
+		case <-h.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,31 @@
+package http_mux
+
+import (
+	"context"
+	"github.com/quantum0cat/simple-http-mux/internal/http_fetcher"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+)
+
+// Fetcher
+//fetches urls of a single request, http_fetcher.HttpFetcher is the default implementation
+type Fetcher interface {
+	//returns responses in the order of urls
+	Fetch(ctx context.Context) ([]models.Response, error)
+	//calls onResponse for every url in the order of completion
+	FetchEach(ctx context.Context, onResponse func(models.Response)) error
+}
+
+// FetcherFactory
+//creates a Fetcher for urls of a single request with the fetch options resolved for it
+type FetcherFactory func(rid string, specs []models.UrlSpec, opts http_fetcher.Options) (Fetcher, error)
+
+// NewHttpFetcher
+//FetcherFactory of http_fetcher.HttpFetcher
+func NewHttpFetcher(rid string, specs []models.UrlSpec, opts http_fetcher.Options) (Fetcher, error) {
+	fetcher, err := http_fetcher.NewHttpFetcher(rid, specs, opts)
+	if err != nil {
+		//don't wrap the nil pointer into a non-nil interface
+		return nil, err
+	}
+	return fetcher, nil
+}
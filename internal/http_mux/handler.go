@@ -3,89 +3,176 @@ package http_mux
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/cache"
+	"github.com/quantum0cat/simple-http-mux/internal/coalesce"
 	"github.com/quantum0cat/simple-http-mux/internal/http_fetcher"
 	"github.com/quantum0cat/simple-http-mux/internal/models"
-	"github.com/quantum0cat/simple-http-mux/pkg/utils"
+	"github.com/quantum0cat/simple-http-mux/pkg/logging"
 	"io"
-	"log"
+	"mime"
 	"net/http"
+	"strings"
 	"sync/atomic"
-	"time"
 )
 
-const maxUrlsPerRequest = 20
-
 type muxHandler struct {
-	ctx context.Context
-	rid uint32
+	ctx        context.Context
+	opts       atomic.Value          //current Options, replaced on reload
+	transport  http.RoundTripper     //transport shared by all fetches, http.DefaultTransport if nil
+	newFetcher FetcherFactory        //creates a fetcher for every request
+	cache      *cache.Cache          //cache shared by all fetches, nil if disabled
+	coalesce   *coalesce.Group       //upstream requests in flight of all fetches
+	observer   http_fetcher.Observer //receives fetch events to collect metrics, may be nil
+	log        *logging.Logger       //logger of the mux
 }
 
-func newMuxHandler(ctx context.Context) *muxHandler {
-	return &muxHandler{
-		ctx: ctx,
-		rid: 0,
+func newMuxHandler(ctx context.Context, opts Options) *muxHandler {
+	h := &muxHandler{
+		ctx:        ctx,
+		newFetcher: NewHttpFetcher,
+		coalesce:   coalesce.New(),
+		log:        logging.Discard(),
 	}
+	h.setOptions(opts)
+	return h
+}
+
+//replaces options, requests in progress keep using the options they started with
+func (h *muxHandler) setOptions(opts Options) {
+	h.opts.Store(opts.withDefaults())
+}
+
+func (h *muxHandler) options() Options {
+	return h.opts.Load().(Options)
 }
 
 func (h *muxHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	rid := atomic.AddUint32(&h.rid, 1)
+	rid := requestId(r)
+	opts := h.options()
+	log := h.log.With("rid", rid)
+	stats := requestStats(r)
 
-	log.Printf("Incoming request from %s\n", r.RemoteAddr)
+	log.Debug("Incoming request", "remote", r.RemoteAddr, "path", r.URL.Path)
 	//validate method (only POST)
 	if r.Method != http.MethodPost {
-		sendError(w, utils.WithRid("Only POST method is supported", rid), http.StatusMethodNotAllowed)
+		w.Header().Set("Allow", http.MethodPost)
+		sendError(w, rid, ErrCodeMethodNotAllowed, "Only POST method is supported", nil)
 		return
 	}
-	defer func() { _ = r.Body.Close() }()
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		sendError(w, utils.WithRid("Unable to read request body", rid), http.StatusInternalServerError)
+	body, ok := readBody(w, r, opts.MaxRequestBodyBytes, rid)
+	if !ok {
 		return
 	}
 	if len(body) == 0 {
-		sendError(w, utils.WithRid("Request body is empty", rid), http.StatusInternalServerError)
+		sendError(w, rid, ErrCodeEmptyBody, "Request body is empty", nil)
 		return
 	}
 	var dto models.UrlsDto
-	err = json.Unmarshal(body, &dto)
+	err := json.Unmarshal(body, &dto)
 	if err != nil {
-		sendError(w, utils.WithRid("Incorrect JSON in request body", rid), http.StatusInternalServerError)
+		sendError(w, rid, ErrCodeInvalidJson, "Incorrect JSON in request body", map[string]string{"error": err.Error()})
+		return
+	}
+	if len(dto.Urls) == 0 {
+		sendError(w, rid, ErrCodeNoUrls, "No urls in request", nil)
+		return
+	}
+	stats.setUrls(len(dto.Urls))
+	if len(dto.Urls) > opts.MaxUrlsPerRequest {
+		sendError(w, rid, ErrCodeTooManyUrls, fmt.Sprintf("More than %d urls in request", opts.MaxUrlsPerRequest),
+			map[string]int{"max": opts.MaxUrlsPerRequest, "count": len(dto.Urls)})
 		return
 	}
-	if len(dto.Urls) > maxUrlsPerRequest {
-		sendError(w, utils.WithRid("More then 20 urls in", rid), http.StatusInternalServerError)
+	fetchOpts, err := opts.fetchOptions(&dto)
+	if err != nil {
+		sendError(w, rid, ErrCodeInvalidOptions, err.Error(), nil)
 		return
 	}
+	fetchOpts.Transport = h.transport
+	fetchOpts.Cache = h.cache
+	fetchOpts.Observer = h.observer
+	fetchOpts.Logger = h.log
+	if opts.CoalesceRequests {
+		fetchOpts.Coalesce = h.coalesce
+	}
 
-	fetcher, err := http_fetcher.NewHttpFetcher(
-		rid,
-		dto.Urls,
-		4,
-		10*time.Second,
-		1*time.Second,
-	)
+	specs, err := opts.urlSpecs(dto.Urls)
 	if err != nil {
-		sendError(w, utils.WithRid(err.Error(), rid), http.StatusInternalServerError)
+		sendError(w, rid, ErrCodeInvalidOptions, err.Error(), nil)
 		return
 	}
 
-	resps, err := fetcher.Fetch(h.ctx)
+	fetcher, err := h.newFetcher(rid, specs, fetchOpts)
+	var invalid *http_fetcher.InvalidUrlsError
+	if errors.As(err, &invalid) {
+		sendError(w, rid, ErrCodeInvalidUrls, "Invalid urls", map[string]interface{}{"urls": invalid.Urls})
+		return
+	}
 	if err != nil {
-		log.Printf("%s", utils.WithRid(err.Error(), rid))
-		sendError(w, utils.WithRid(err.Error(), rid), http.StatusInternalServerError)
+		log.Error("Failed to create a fetcher", "error", err)
+		sendError(w, rid, ErrCodeInternal, err.Error(), nil)
 		return
 	}
 
+	//stop fetching if the client is gone or the server is stopping
+	ctx, cancel := h.requestContext(r)
+	defer cancel()
+
+	if contentType := streamContentType(r); contentType != "" {
+		h.streamResults(ctx, w, r, fetcher, contentType, log)
+		return
+	}
+
+	resps, err := fetcher.Fetch(ctx)
+	if err != nil {
+		code := h.fetchErrorCode(r, err)
+		if code == ErrCodeUpstreamFailed {
+			stats.addFailure()
+		}
+		log.Warn("Fetch failed", "code", code, "error", err)
+		sendError(w, rid, code, err.Error(), nil)
+		return
+	}
+
+	for i := range resps {
+		stats.add(&resps[i])
+	}
 	data, err := json.Marshal(resps)
 	if err != nil {
-		sendError(w, utils.WithRid(err.Error(), rid), http.StatusInternalServerError)
+		sendError(w, rid, ErrCodeInternal, err.Error(), nil)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	w.Header().Add("Content-Type", "application/json; charset=utf-8")
 	_, err = w.Write(data)
 	if err != nil {
-		log.Printf("Failed to write data to response : %s", utils.WithRid(err.Error(), rid))
+		log.Warn("Failed to write data to response", "error", err)
+	}
+}
+
+//reads the request body up to the limit, sends an error and returns false if it's not a JSON or it's too large
+func readBody(w http.ResponseWriter, r *http.Request, limit int64, rid string) ([]byte, bool) {
+	defer func() { _ = r.Body.Close() }()
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+			sendError(w, rid, ErrCodeUnsupportedMediaType, "Request body must be JSON",
+				map[string]string{"content_type": contentType})
+			return nil, false
+		}
+	}
+	//read one byte more than allowed to find out, that the body is too large
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		sendError(w, rid, ErrCodeInternal, "Unable to read request body", nil)
+		return nil, false
+	}
+	if int64(len(body)) > limit {
+		sendError(w, rid, ErrCodeBodyTooLarge, "Request body is too large", map[string]int64{"max_bytes": limit})
+		return nil, false
 	}
+	return body, true
 }
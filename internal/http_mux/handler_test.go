@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/http_fetcher"
 	"github.com/quantum0cat/simple-http-mux/internal/models"
 	"github.com/stretchr/testify/assert"
 	"io"
@@ -15,17 +17,15 @@ import (
 
 func Test_muxHandler_ServeHTTP(t *testing.T) {
 
-	handler := &muxHandler{
-		ctx: context.Background(),
-	}
+	handler := newMuxHandler(context.Background(), Options{})
 
 	//generate not allowed count of urls
-	urls := make([]string, maxUrlsPerRequest+1)
+	urls := make([]string, defaultMaxUrlsPerRequest+1)
 
-	for i := 0; i <= maxUrlsPerRequest; i++ {
+	for i := 0; i <= defaultMaxUrlsPerRequest; i++ {
 		urls[i] = fmt.Sprintf("url%d", i)
 	}
-	dto := models.UrlsDto{Urls: urls}
+	dto := models.UrlsDto{Urls: models.NewUrlSpecs(urls)}
 	unallowedUrlsData, err := json.Marshal(dto)
 	fmt.Printf("%v", string(unallowedUrlsData))
 
@@ -35,17 +35,19 @@ func Test_muxHandler_ServeHTTP(t *testing.T) {
 		name       string
 		request    *http.Request
 		statusCode int
-		errMessage string
+		errCode    string
 	}{
 		{
 			name:       "failing1",
 			request:    httptest.NewRequest(http.MethodGet, "http://localhost", nil),
 			statusCode: http.StatusMethodNotAllowed,
+			errCode:    ErrCodeMethodNotAllowed,
 		},
 		{
 			name:       "failing2",
 			request:    httptest.NewRequest(http.MethodPost, "http://localhost", nil),
-			statusCode: http.StatusInternalServerError,
+			statusCode: http.StatusBadRequest,
+			errCode:    ErrCodeEmptyBody,
 		},
 		{
 			name: "failing3",
@@ -54,7 +56,8 @@ func Test_muxHandler_ServeHTTP(t *testing.T) {
 				"http://localhost",
 				bytes.NewBuffer([]byte(`[`)),
 			),
-			statusCode: http.StatusInternalServerError,
+			statusCode: http.StatusBadRequest,
+			errCode:    ErrCodeInvalidJson,
 		},
 		{
 			name: "failing4",
@@ -63,7 +66,58 @@ func Test_muxHandler_ServeHTTP(t *testing.T) {
 				"http://localhost",
 				bytes.NewBuffer(unallowedUrlsData),
 			),
-			statusCode: http.StatusInternalServerError,
+			statusCode: http.StatusUnprocessableEntity,
+			errCode:    ErrCodeTooManyUrls,
+		},
+		{
+			name: "too large body",
+			request: httptest.NewRequest(
+				http.MethodPost,
+				"http://localhost",
+				bytes.NewBuffer(bytes.Repeat([]byte(" "), defaultMaxRequestBody+1)),
+			),
+			statusCode: http.StatusRequestEntityTooLarge,
+			errCode:    ErrCodeBodyTooLarge,
+		},
+		{
+			name: "no urls",
+			request: httptest.NewRequest(
+				http.MethodPost,
+				"http://localhost",
+				bytes.NewBuffer([]byte(`{"urls": []}`)),
+			),
+			statusCode: http.StatusUnprocessableEntity,
+			errCode:    ErrCodeNoUrls,
+		},
+		{
+			name: "invalid method",
+			request: httptest.NewRequest(
+				http.MethodPost,
+				"http://localhost",
+				bytes.NewBuffer([]byte(`{"urls": ["http://localhost"], "method": "CONNECT"}`)),
+			),
+			statusCode: http.StatusUnprocessableEntity,
+			errCode:    ErrCodeInvalidOptions,
+		},
+		{
+			name: "invalid urls",
+			request: httptest.NewRequest(
+				http.MethodPost,
+				"http://localhost",
+				bytes.NewBuffer([]byte(`{"urls": ["http://localhost", "localhost", "http://[::1"]}`)),
+			),
+			statusCode: http.StatusUnprocessableEntity,
+			errCode:    ErrCodeInvalidUrls,
+		},
+		{
+			name: "not json",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "http://localhost", bytes.NewBuffer([]byte(`urls=x`)))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				return r
+			}(),
+			statusCode: http.StatusUnsupportedMediaType,
+			errCode:    ErrCodeUnsupportedMediaType,
 		},
 	}
 	for _, tt := range tests {
@@ -77,8 +131,105 @@ func Test_muxHandler_ServeHTTP(t *testing.T) {
 			body, err := io.ReadAll(r.Body)
 			assert.NoError(t, err, "failed to read response body")
 
+			var dto models.ErrorDto
+			assert.NoError(t, json.Unmarshal(body, &dto), "failed to parse error")
+			assert.Equal(t, tt.errCode, dto.Code, "error codes don't match")
+			assert.NotEmpty(t, dto.RequestId, "request id is missing")
+
 			fmt.Printf("%s", string(body))
 
 		})
 	}
 }
+
+//returns responses made from url specs without any network requests
+type fakeFetcher struct {
+	specs []models.UrlSpec
+	err   error
+}
+
+func (f *fakeFetcher) Fetch(ctx context.Context) ([]models.Response, error) {
+	var resps []models.Response
+	err := f.FetchEach(ctx, func(resp models.Response) {
+		resps = append(resps, resp)
+	})
+	return resps, err
+}
+
+func (f *fakeFetcher) FetchEach(_ context.Context, onResponse func(models.Response)) error {
+	if f.err != nil {
+		return f.err
+	}
+	for i, spec := range f.specs {
+		onResponse(models.Response{Index: i, Url: spec.Url, Status: models.StatusOk, Response: spec.Method})
+	}
+	return nil
+}
+
+func Test_muxHandler_newFetcher(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		dto        models.UrlsDto
+		err        error
+		cancelled  bool //the client is gone
+		statusCode int
+		want       []models.Response
+	}{
+		{
+			name:       "responses",
+			dto:        models.UrlsDto{Urls: models.NewUrlSpecs([]string{"fake://a", "fake://b"}), Method: http.MethodHead},
+			statusCode: http.StatusOK,
+			want: []models.Response{
+				{Index: 0, Url: "fake://a", Status: models.StatusOk, Response: http.MethodHead},
+				{Index: 1, Url: "fake://b", Status: models.StatusOk, Response: http.MethodHead},
+			},
+		},
+		{
+			name:       "error",
+			dto:        models.UrlsDto{Urls: models.NewUrlSpecs([]string{"fake://a"})},
+			err:        errors.New("fetch failed"),
+			statusCode: http.StatusBadGateway,
+		},
+		{
+			name:       "timeout",
+			dto:        models.UrlsDto{Urls: models.NewUrlSpecs([]string{"fake://a"})},
+			err:        context.DeadlineExceeded,
+			statusCode: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "client closed request",
+			dto:        models.UrlsDto{Urls: models.NewUrlSpecs([]string{"fake://a"})},
+			err:        context.Canceled,
+			cancelled:  true,
+			statusCode: statusClientClosedRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newMuxHandler(context.Background(), Options{})
+			handler.newFetcher = func(rid string, specs []models.UrlSpec, opts http_fetcher.Options) (Fetcher, error) {
+				for i := range specs {
+					specs[i].Method = opts.Method
+				}
+				return &fakeFetcher{specs: specs, err: tt.err}, nil
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "http://localhost", bytes.NewBuffer(tt.dto.Marshal()))
+			if tt.cancelled {
+				ctx, cancel := context.WithCancel(r.Context())
+				cancel()
+				r = r.WithContext(ctx)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tt.statusCode, w.Code, "status codes don't match")
+			if tt.want == nil {
+				return
+			}
+			var got []models.Response
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got), "failed to parse response")
+			assert.Equal(t, tt.want, got, "responses don't match")
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package http_mux
+
+import (
+	"encoding/json"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"net/http"
+	"sync/atomic"
+)
+
+// Drain
+//marks the mux as not ready, so load balancers stop sending new requests, requests are still served until Shutdown
+func (h *HttpMux) Drain() {
+	if atomic.CompareAndSwapInt32(&h.draining, 0, 1) {
+		h.log.Info("HttpMux is draining, readiness probe fails from now on")
+	}
+}
+
+// Alive
+//tells whether the server goroutine is serving the listener
+func (h *HttpMux) Alive() bool {
+	return atomic.LoadInt32(&h.serving) == 1
+}
+
+// Ready
+//tells whether the mux accepts new requests: it's alive and not draining
+func (h *HttpMux) Ready() bool {
+	return h.Alive() && atomic.LoadInt32(&h.draining) == 0
+}
+
+//liveness probe
+func (h *HttpMux) healthz(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case h.Alive():
+		sendHealth(w, r, models.HealthOk, http.StatusOK)
+	default:
+		sendHealth(w, r, models.HealthDown, http.StatusServiceUnavailable)
+	}
+}
+
+//readiness probe
+func (h *HttpMux) readyz(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case !h.Alive():
+		sendHealth(w, r, models.HealthDown, http.StatusServiceUnavailable)
+	case !h.Ready():
+		sendHealth(w, r, models.HealthDraining, http.StatusServiceUnavailable)
+	default:
+		sendHealth(w, r, models.HealthOk, http.StatusOK)
+	}
+}
+
+func sendHealth(w http.ResponseWriter, r *http.Request, status string, statusCode int) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		sendError(w, requestId(r), ErrCodeMethodNotAllowed, "Only GET method is supported", nil)
+		return
+	}
+	data, err := json.Marshal(models.Health{Status: status})
+	if err != nil {
+		sendError(w, requestId(r), ErrCodeInternal, err.Error(), nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,53 @@
+package http_mux
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHttpMux_health(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		serving    bool
+		draining   bool
+		path       string
+		method     string
+		statusCode int
+		wantBody   string
+	}{
+		{name: "alive", serving: true, path: "/healthz", statusCode: http.StatusOK, wantBody: `{"status":"ok"}`},
+		{name: "alive while draining", serving: true, draining: true, path: "/healthz", statusCode: http.StatusOK, wantBody: `{"status":"ok"}`},
+		{name: "not alive", path: "/healthz", statusCode: http.StatusServiceUnavailable, wantBody: `{"status":"down"}`},
+		{name: "ready", serving: true, path: "/readyz", statusCode: http.StatusOK, wantBody: `{"status":"ok"}`},
+		{name: "draining", serving: true, draining: true, path: "/readyz", statusCode: http.StatusServiceUnavailable, wantBody: `{"status":"draining"}`},
+		{name: "not ready", path: "/readyz", statusCode: http.StatusServiceUnavailable, wantBody: `{"status":"down"}`},
+		{name: "method", serving: true, path: "/readyz", method: http.MethodPost, statusCode: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := NewHttpMux(context.Background(), 10000, 100, Options{}, nil)
+			if tt.serving {
+				atomic.StoreInt32(&mux.serving, 1)
+			}
+			if tt.draining {
+				mux.Drain()
+			}
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			w := httptest.NewRecorder()
+			mux.server.Handler.ServeHTTP(w, httptest.NewRequest(method, "http://localhost"+tt.path, nil))
+			assert.Equal(t, tt.statusCode, w.Code, "status codes don't match")
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, w.Body.String(), "bodies don't match")
+			}
+		})
+	}
+}
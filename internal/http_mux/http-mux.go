@@ -3,35 +3,79 @@ package http_mux
 import (
 	"context"
 	"errors"
-	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/cache"
+	"github.com/quantum0cat/simple-http-mux/internal/transport"
+	"github.com/quantum0cat/simple-http-mux/pkg/logging"
 	"github.com/quantum0cat/simple-http-mux/pkg/netutil"
-	"log"
 	"net"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
 type HttpMux struct {
 	listener       net.Listener
 	server         *http.Server
+	handler        *muxHandler
+	transport      *transport.Transport
+	cache          *cache.Cache //nil if disabled
+	metrics        *muxMetrics
+	accessLog      *accessLogger //nil if disabled
+	log            *logging.Logger
+	activeListener atomic.Value //net.Listener, which is accepting connections
+	serving        int32        //1 while the server goroutine is serving the listener
+	draining       int32        //1 after Drain, the mux is not ready for new requests
+	bindAddress    string
 	port           uint16
 	maxConnections uint
 }
 
-func NewHttpMux(ctx context.Context, port uint16, maxConnections uint) *HttpMux {
+// NewHttpMux
+//creates an HttpMux, which fetches urls with fetchers made by newFetcher, NewHttpFetcher is used if it's nil
+func NewHttpMux(ctx context.Context, port uint16, maxConnections uint, opts Options, newFetcher FetcherFactory) *HttpMux {
 
-	handler := newMuxHandler(ctx)
-
-	server := &http.Server{
-		Handler:           handler,
-		ReadHeaderTimeout: 1 * time.Second,
-		MaxHeaderBytes:    1 << 20,
+	logger := opts.Logger
+	if logger == nil {
+		logger = logging.Discard()
+	}
+	upstream := transport.New(opts.Transport)
+	handler := newMuxHandler(ctx, opts)
+	handler.transport = upstream
+	handler.log = logger
+	if newFetcher != nil {
+		handler.newFetcher = newFetcher
+	}
+	if opts.Cache.MaxBytes > 0 {
+		handler.cache = cache.New(opts.Cache)
 	}
-	return &HttpMux{
-		server:         server,
+
+	mux := &HttpMux{
+		handler:        handler,
+		transport:      upstream,
+		cache:          handler.cache,
+		log:            logger,
+		bindAddress:    opts.BindAddress,
 		port:           port,
 		maxConnections: maxConnections,
 	}
+	mux.metrics = newMuxMetrics(mux)
+	if opts.AccessLog != nil {
+		format := opts.AccessLogFormat
+		if format == "" {
+			format = AccessLogCombined
+		}
+		mux.accessLog = &accessLogger{w: opts.AccessLog, format: format}
+	}
+	handler.observer = mux.metrics
+
+	mux.server = &http.Server{
+		Handler:           mux.routes(),
+		ReadHeaderTimeout: 1 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+		ErrorLog:          logger.StdLogger(logging.LevelWarn),
+	}
+	return mux
 
 }
 
@@ -42,33 +86,34 @@ func (h *HttpMux) Run() error {
 	}
 
 	//create a default listener
-	h.listener, err = net.Listen("tcp", fmt.Sprintf(":%d", h.port))
+	h.listener, err = net.Listen("tcp", net.JoinHostPort(h.bindAddress, strconv.Itoa(int(h.port))))
 	if err != nil {
 		return err
 	}
 
 	//if we got max connections limitations, upgrade the default listener
-	maxConnsStr := ""
 	if h.maxConnections > 0 {
 		h.listener = netutil.LimitListener(h.listener, int(h.maxConnections))
-		maxConnsStr = fmt.Sprintf("Max connections = %d", h.maxConnections)
 	}
+	h.activeListener.Store(h.listener)
 	defer func() {
 		err = h.server.Shutdown(context.Background())
 		if err != nil {
-			log.Printf("Failed to close server %s...", err.Error())
+			h.log.Error("Failed to close server", "error", err)
 		}
 	}()
 
-	log.Printf("HttpMux started. Listening on %s. %s", h.listener.Addr().String(), maxConnsStr)
+	h.log.Info("HttpMux started", "address", h.listener.Addr().String(), "max_connections", h.maxConnections)
 
+	atomic.StoreInt32(&h.serving, 1)
 	err = h.server.Serve(h.listener)
+	atomic.StoreInt32(&h.serving, 0)
 	switch {
 	case errors.Is(err, http.ErrServerClosed):
-		log.Printf("HttpMux stopped gracefully.")
+		h.log.Info("HttpMux stopped gracefully")
 		return nil
 	default:
-		log.Printf("Error occured during HTTP server execution :%s", err.Error())
+		h.log.Error("Error occured during HTTP server execution", "error", err)
 		return err
 	}
 
@@ -76,5 +121,28 @@ func (h *HttpMux) Run() error {
 
 func (h *HttpMux) Shutdown(ctx context.Context) error {
 	err := h.server.Shutdown(ctx)
+	h.transport.CloseIdleConnections()
 	return err
 }
+
+// Reload
+//applies new options to the running HttpMux, requests in progress are not affected.
+//BindAddress, Transport, Cache, Logger and access log settings can't be changed without restart and are ignored.
+func (h *HttpMux) Reload(opts Options) {
+	h.handler.setOptions(opts)
+}
+
+// TransportStats
+//returns statistics of the upstream connection pool
+func (h *HttpMux) TransportStats() transport.Stats {
+	return h.transport.Stats()
+}
+
+// CacheStats
+//returns statistics of the upstream responses cache, false if the cache is disabled
+func (h *HttpMux) CacheStats() (cache.Stats, bool) {
+	if h.cache == nil {
+		return cache.Stats{}, false
+	}
+	return h.cache.Stats(), true
+}
@@ -24,7 +24,7 @@ func TestNewHttpMux(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mux := NewHttpMux(context.Background(), 10000, 100)
+			mux := NewHttpMux(context.Background(), 10000, 100, Options{}, nil)
 			assert.NotNil(t, mux, "constructor returned nil")
 		})
 	}
@@ -50,7 +50,7 @@ func TestHttpMux_Run(t *testing.T) {
 	urls := make([]string, testServersCount)
 	responses := make([]models.Response, testServersCount)
 	requests := make([]*http.Request, testServersCount)
-	portUrl := fmt.Sprintf("http://localhost:%d", serverPort)
+	portUrl := fmt.Sprintf("http://localhost:%d%s", serverPort, PathFetch)
 	var err error
 	for i := 0; i < testServersCount; i++ {
 		testServers[i] = httptest.NewServer(http.HandlerFunc(generateHandlerFunc(i)))
@@ -61,7 +61,7 @@ func TestHttpMux_Run(t *testing.T) {
 		}
 
 	}
-	dto := models.UrlsDto{Urls: urls}
+	dto := models.UrlsDto{Urls: models.NewUrlSpecs(urls)}
 	data := dto.Marshal()
 	for i := 0; i < testServersCount; i++ {
 		requests[i], err = http.NewRequest(
@@ -99,7 +99,7 @@ func TestHttpMux_Run(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			mux := NewHttpMux(context.Background(), tt.port, tt.maxConnections)
+			mux := NewHttpMux(context.Background(), tt.port, tt.maxConnections, Options{}, nil)
 			go func() {
 				time.Sleep(2 * time.Second)
 				_ = mux.Shutdown(context.Background())
@@ -128,3 +128,14 @@ func TestHttpMux_Run(t *testing.T) {
 		})
 	}
 }
+
+func TestHttpMux_Reload(t *testing.T) {
+
+	mux := NewHttpMux(context.Background(), 10000, 100, Options{}, nil)
+	assert.Equal(t, defaultMaxUrlsPerRequest, mux.handler.options().MaxUrlsPerRequest, "default options are not applied")
+
+	mux.Reload(Options{MaxUrlsPerRequest: 5})
+	opts := mux.handler.options()
+	assert.Equal(t, 5, opts.MaxUrlsPerRequest, "options are not reloaded")
+	assert.Equal(t, defaultWorkers, opts.Workers, "default options are not applied on reload")
+}
@@ -0,0 +1,216 @@
+package http_mux
+
+import (
+	"github.com/quantum0cat/simple-http-mux/internal/metrics"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/quantum0cat/simple-http-mux/pkg/netutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const metricsPrefix = "simple_http_mux_"
+
+//max distinct hosts of upstream metrics, hosts come from urls of clients, so the rest are labeled otherHost
+//to keep series count bounded
+const (
+	maxMetricsHosts = 100
+	otherHost       = "other"
+)
+
+//metrics of HttpMux, implements http_fetcher.Observer to collect upstream metrics
+type muxMetrics struct {
+	registry        *metrics.Registry
+	requests        *metrics.CounterVec
+	requestDuration *metrics.HistogramVec
+	fetches         *metrics.CounterVec
+	fetchDuration   *metrics.HistogramVec
+	fetchErrors     *metrics.CounterVec
+	workers         *metrics.GaugeVec
+	hostsMu         sync.Mutex
+	hosts           map[string]struct{} //hosts, which got their own label
+}
+
+func newMuxMetrics(mux *HttpMux) *muxMetrics {
+	registry := metrics.NewRegistry()
+	m := &muxMetrics{
+		registry: registry,
+		requests: registry.Counter(metricsPrefix+"requests_total",
+			"Inbound requests by handler and response status code.", "handler", "code"),
+		requestDuration: registry.Histogram(metricsPrefix+"request_duration_seconds",
+			"Inbound requests latency by handler and response status code.", metrics.DefaultBuckets, "handler", "code"),
+		fetches: registry.Counter(metricsPrefix+"upstream_fetches_total",
+			"Upstream url fetches by host and status.", "host", "status"),
+		fetchDuration: registry.Histogram(metricsPrefix+"upstream_fetch_duration_seconds",
+			"Upstream url fetches latency including retries by host.", metrics.DefaultBuckets, "host"),
+		fetchErrors: registry.Counter(metricsPrefix+"upstream_fetch_errors_total",
+			"Upstream url fetches, which failed or timed out, by host.", "host"),
+		workers: registry.Gauge(metricsPrefix+"active_workers",
+			"Fetch workers, which are running now."),
+		hosts: map[string]struct{}{},
+	}
+	m.workers.Set(0)
+
+	registry.Func(metricsPrefix+"listener_connections", "Inbound connections, which are open now.", metrics.TypeGauge, nil,
+		func() []metrics.Sample {
+			stats, ok := netutil.Stats(mux.currentListener())
+			if !ok {
+				return nil
+			}
+			return []metrics.Sample{{Value: float64(stats.Active)}}
+		})
+	registry.Func(metricsPrefix+"listener_connections_limit", "Max inbound connections.", metrics.TypeGauge, nil,
+		func() []metrics.Sample {
+			stats, ok := netutil.Stats(mux.currentListener())
+			if !ok {
+				return nil
+			}
+			return []metrics.Sample{{Value: float64(stats.Limit)}}
+		})
+
+	registry.Func(metricsPrefix+"upstream_connections", "Upstream connections, which are open now, by host.", metrics.TypeGauge,
+		[]string{"host"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for host, count := range mux.transport.Stats().OpenByHost {
+				samples = append(samples, metrics.Sample{LabelValues: []string{host}, Value: float64(count)})
+			}
+			return samples
+		})
+	registry.Func(metricsPrefix+"upstream_dials_total", "Upstream connections established.", metrics.TypeCounter, nil,
+		func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(mux.transport.Stats().Dials)}}
+		})
+	registry.Func(metricsPrefix+"upstream_reused_connections_total", "Upstream requests sent over pooled connections.",
+		metrics.TypeCounter, nil, func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(mux.transport.Stats().ReusedConns)}}
+		})
+
+	if mux.cache != nil {
+		registry.Func(metricsPrefix+"cache_entries", "Cached upstream responses.", metrics.TypeGauge, nil,
+			func() []metrics.Sample {
+				return []metrics.Sample{{Value: float64(mux.cache.Stats().Entries)}}
+			})
+		registry.Func(metricsPrefix+"cache_bytes", "Size of cached upstream responses.", metrics.TypeGauge, nil,
+			func() []metrics.Sample {
+				return []metrics.Sample{{Value: float64(mux.cache.Stats().Bytes)}}
+			})
+		registry.Func(metricsPrefix+"cache_lookups_total", "Cache lookups by result.", metrics.TypeCounter,
+			[]string{"result"}, func() []metrics.Sample {
+				stats := mux.cache.Stats()
+				return []metrics.Sample{
+					{LabelValues: []string{"hit"}, Value: float64(stats.Hits)},
+					{LabelValues: []string{"miss"}, Value: float64(stats.Misses)},
+				}
+			})
+		registry.Func(metricsPrefix+"cache_evictions_total", "Cached responses evicted to free space.", metrics.TypeCounter, nil,
+			func() []metrics.Sample {
+				return []metrics.Sample{{Value: float64(mux.cache.Stats().Evictions)}}
+			})
+	}
+	return m
+}
+
+func (m *muxMetrics) WorkerStarted() {
+	m.workers.Add(1)
+}
+
+func (m *muxMetrics) WorkerStopped() {
+	m.workers.Add(-1)
+}
+
+func (m *muxMetrics) UrlFetched(resp *models.Response, duration time.Duration) {
+	host := "invalid"
+	if parsed, err := url.Parse(resp.Url); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+	host = m.hostLabel(host)
+	m.fetches.Inc(host, resp.Status)
+	m.fetchDuration.Observe(duration.Seconds(), host)
+	if resp.Status == models.StatusError || resp.Status == models.StatusTimeout {
+		m.fetchErrors.Inc(host)
+	}
+}
+
+//returns the label of the host, hosts beyond the limit share otherHost
+func (m *muxMetrics) hostLabel(host string) string {
+	m.hostsMu.Lock()
+	defer m.hostsMu.Unlock()
+	if _, ok := m.hosts[host]; ok {
+		return host
+	}
+	if len(m.hosts) >= maxMetricsHosts {
+		return otherHost
+	}
+	m.hosts[host] = struct{}{}
+	return host
+}
+
+//serves the metrics, other methods than GET and HEAD get the API error
+func (m *muxMetrics) handler() http.Handler {
+	exposition := m.registry.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+			sendError(w, requestId(r), ErrCodeMethodNotAllowed, "Only GET method is supported", nil)
+			return
+		}
+		exposition.ServeHTTP(w, r)
+	})
+}
+
+//counts requests to the handler and measures their latency
+func (m *muxMetrics) instrument(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		code := strconv.Itoa(recorder.statusCode())
+		m.requests.Inc(name, code)
+		m.requestDuration.Observe(time.Since(started).Seconds(), name, code)
+	})
+}
+
+//remembers the status code and the body size of the response, keeps streaming available
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64 //body bytes written
+}
+
+func (s *statusRecorder) WriteHeader(statusCode int) {
+	if s.status == 0 {
+		s.status = statusCode
+	}
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(data)
+	s.written += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) statusCode() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+//listener, which is accepting connections, nil if HttpMux is not running
+func (h *HttpMux) currentListener() net.Listener {
+	listener, _ := h.activeListener.Load().(net.Listener)
+	return listener
+}
@@ -0,0 +1,81 @@
+package http_mux
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/cache"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHttpMux_metrics(t *testing.T) {
+
+	upstream := httptest.NewServer(http.HandlerFunc(generateHandlerFunc(0)))
+	defer upstream.Close()
+	host := strings.TrimPrefix(upstream.URL, "http://")
+
+	mux := NewHttpMux(context.Background(), 10000, 100, Options{Cache: cache.Config{MaxBytes: 1 << 20}}, nil)
+	dto := models.UrlsDto{Urls: models.NewUrlSpecs([]string{upstream.URL, "http://127.0.0.1:1"})}
+	w := httptest.NewRecorder()
+	mux.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://localhost"+PathFetch, bytes.NewBuffer(dto.Marshal())))
+	assert.Equal(t, http.StatusOK, w.Code, "status codes don't match")
+	w = httptest.NewRecorder()
+	mux.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://localhost"+PathFetch, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code, "status codes don't match")
+
+	w = httptest.NewRecorder()
+	mux.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://localhost/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "status codes don't match")
+	body := w.Body.String()
+	for _, want := range []string{
+		`simple_http_mux_requests_total{handler="fetch",code="200"} 1`,
+		`simple_http_mux_requests_total{handler="fetch",code="405"} 1`,
+		`simple_http_mux_request_duration_seconds_count{handler="fetch",code="200"} 1`,
+		fmt.Sprintf(`simple_http_mux_upstream_fetches_total{host=%q,status="ok"} 1`, host),
+		`simple_http_mux_upstream_fetches_total{host="127.0.0.1:1",status="error"} 1`,
+		`simple_http_mux_upstream_fetch_errors_total{host="127.0.0.1:1"} 1`,
+		fmt.Sprintf(`simple_http_mux_upstream_fetch_duration_seconds_count{host=%q} 1`, host),
+		`simple_http_mux_active_workers 0`,
+		`simple_http_mux_upstream_dials_total 1`,
+		`simple_http_mux_cache_lookups_total{result="miss"} 2`,
+	} {
+		assert.Contains(t, body, want+"\n", "metric is missing")
+	}
+}
+
+func TestHttpMux_metricsMethod(t *testing.T) {
+
+	mux := NewHttpMux(context.Background(), 10000, 100, Options{}, nil)
+	w := httptest.NewRecorder()
+	mux.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://localhost"+PathMetrics, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code, "status codes don't match")
+
+	var dto models.ErrorDto
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &dto), "failed to parse error")
+	assert.Equal(t, ErrCodeMethodNotAllowed, dto.Code, "error codes don't match")
+}
+
+func Test_muxMetrics_hostLabel(t *testing.T) {
+
+	mux := NewHttpMux(context.Background(), 10000, 100, Options{}, nil)
+	for i := 0; i <= maxMetricsHosts; i++ {
+		mux.metrics.UrlFetched(&models.Response{Url: fmt.Sprintf("http://host%d", i), Status: models.StatusOk}, 0)
+	}
+	mux.metrics.UrlFetched(&models.Response{Url: "http://host0", Status: models.StatusOk}, 0)
+
+	var out bytes.Buffer
+	_, err := mux.metrics.registry.WriteTo(&out)
+	assert.NoError(t, err, "failed to write metrics")
+	body := out.String()
+	assert.Contains(t, body, `simple_http_mux_upstream_fetches_total{host="host0",status="ok"} 2`+"\n", "known host is not labeled")
+	assert.Contains(t, body, fmt.Sprintf(`simple_http_mux_upstream_fetches_total{host="host%d",status="ok"} 1`, maxMetricsHosts-1)+"\n",
+		"host within the limit is not labeled")
+	assert.Contains(t, body, `simple_http_mux_upstream_fetches_total{host="other",status="ok"} 1`+"\n", "hosts over the limit are not merged")
+	assert.NotContains(t, body, fmt.Sprintf(`host="host%d"`, maxMetricsHosts), "host over the limit is labeled")
+}
@@ -0,0 +1,230 @@
+package http_mux
+
+import (
+	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/cache"
+	"github.com/quantum0cat/simple-http-mux/internal/http_fetcher"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/quantum0cat/simple-http-mux/internal/policy"
+	"github.com/quantum0cat/simple-http-mux/internal/transport"
+	"github.com/quantum0cat/simple-http-mux/pkg/logging"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultMaxUrlsPerRequest = 20
+	defaultWorkers           = 4
+	defaultFetchTimeout      = 10 * time.Second
+	defaultRequestTimeout    = 1 * time.Second
+	defaultMaxRequestBody    = 1 << 20
+	defaultMaxResponseBytes  = 4 << 20
+	defaultMaxBatchBytes     = 16 << 20
+	defaultMaxRetryAttempts  = 3
+)
+
+//HTTP methods, which may be used for upstream requests
+var allowedMethods = map[string]struct{}{
+	http.MethodGet:     {},
+	http.MethodHead:    {},
+	http.MethodPost:    {},
+	http.MethodPut:     {},
+	http.MethodPatch:   {},
+	http.MethodDelete:  {},
+	http.MethodOptions: {},
+}
+
+// Options
+//server-side settings of HttpMux, zero values are replaced with defaults.
+//Max* values clamp the settings requested by clients, by default clients can't exceed the defaults.
+type Options struct {
+	BindAddress         string                   //address to listen on, all interfaces if empty
+	MaxRequestBodyBytes int64                    //max size of inbound request body
+	MaxUrlsPerRequest   int                      //max urls count in a single request
+	Workers             int                      //fetch workers count per request
+	MaxWorkers          int                      //max fetch workers count per request
+	FetchTimeout        time.Duration            //timeout to fetch all urls of a request
+	MaxFetchTimeout     time.Duration            //max timeout to fetch all urls of a request
+	RequestTimeout      time.Duration            //timeout for a single url
+	MaxRequestTimeout   time.Duration            //max timeout for a single url
+	MaxResponseBytes    int64                    //max upstream response body size per url, larger bodies are truncated
+	MaxBatchBytes       int64                    //max upstream response bodies size per request
+	Retry               http_fetcher.RetryPolicy //retry policy, clients may override it
+	MaxRetryAttempts    int                      //max attempts count per url a client may ask for
+	Transport           transport.Config         //upstream connection pool settings, can't be reloaded
+	Cache               cache.Config             //upstream responses cache settings, can't be reloaded
+	CoalesceRequests    bool                     //share identical GET/HEAD upstream requests of concurrent requests
+	LegacyRootFetch     bool                     //serve the fetch API on the root path besides PathFetch
+	Policy              policy.Policy            //restricts urls clients may fetch
+	Logger              *logging.Logger          //logger of the mux and its fetches, can't be reloaded (its level can), nil -> no logs
+	AccessLog           io.Writer                //sink of the access log, can't be reloaded, nil -> no access log
+	AccessLogFormat     string                   //one of AccessLogFormats, AccessLogCombined if empty, can't be reloaded
+}
+
+//returns a copy of options with defaults instead of zero values
+func (o Options) withDefaults() Options {
+	if o.MaxRequestBodyBytes <= 0 {
+		o.MaxRequestBodyBytes = defaultMaxRequestBody
+	}
+	if o.MaxResponseBytes <= 0 {
+		o.MaxResponseBytes = defaultMaxResponseBytes
+	}
+	if o.MaxBatchBytes <= 0 {
+		o.MaxBatchBytes = defaultMaxBatchBytes
+	}
+	if o.MaxRetryAttempts <= 0 {
+		o.MaxRetryAttempts = defaultMaxRetryAttempts
+	}
+	if o.Retry.MaxAttempts > o.MaxRetryAttempts {
+		o.Retry.MaxAttempts = o.MaxRetryAttempts
+	}
+	if o.MaxUrlsPerRequest <= 0 {
+		o.MaxUrlsPerRequest = defaultMaxUrlsPerRequest
+	}
+	o.Workers, o.MaxWorkers = defaultInt(o.Workers, o.MaxWorkers, defaultWorkers)
+	o.FetchTimeout, o.MaxFetchTimeout = defaultDuration(o.FetchTimeout, o.MaxFetchTimeout, defaultFetchTimeout)
+	o.RequestTimeout, o.MaxRequestTimeout = defaultDuration(o.RequestTimeout, o.MaxRequestTimeout, defaultRequestTimeout)
+	return o
+}
+
+//builds fetch options for the request, settings requested by the client are clamped by server-side maximums
+func (o Options) fetchOptions(dto *models.UrlsDto) (http_fetcher.Options, error) {
+	if dto.Method != "" {
+		if _, ok := allowedMethods[dto.Method]; !ok {
+			return http_fetcher.Options{}, fmt.Errorf("method %q is not supported", dto.Method)
+		}
+	}
+	retry, err := o.retryPolicy(dto.Retry)
+	if err != nil {
+		return http_fetcher.Options{}, err
+	}
+	workers := o.Workers
+	if dto.Workers > 0 {
+		workers = dto.Workers
+		if workers > o.MaxWorkers {
+			workers = o.MaxWorkers
+		}
+	}
+	return http_fetcher.Options{
+		MaxWorkers:            workers,
+		FetchTimeout:          clampTimeout(dto.FetchTimeoutMs, o.FetchTimeout, o.MaxFetchTimeout),
+		RequestTimeout:        clampTimeout(dto.RequestTimeoutMs, o.RequestTimeout, o.MaxRequestTimeout),
+		FailFast:              dto.FailFast,
+		Method:                dto.Method,
+		Headers:               dto.Headers,
+		Body:                  dto.Body,
+		MaxResponseBytes:      o.MaxResponseBytes,
+		MaxBatchResponseBytes: o.MaxBatchBytes,
+		FailOnTruncate:        dto.FailOnTruncate,
+		DecodeJson:            dto.DecodeJson,
+		Retry:                 retry,
+		NoCache:               dto.NoCache,
+		Policy:                o.Policy,
+	}, nil
+}
+
+//validates url specs of the request, timeouts of single urls are clamped like the fetch-wide one
+func (o Options) urlSpecs(specs []models.UrlSpec) ([]models.UrlSpec, error) {
+	clamped := make([]models.UrlSpec, len(specs))
+	for i, spec := range specs {
+		if spec.Method != "" {
+			if _, ok := allowedMethods[spec.Method]; !ok {
+				return nil, fmt.Errorf("method %q of url %q is not supported", spec.Method, spec.Url)
+			}
+		}
+		if spec.TimeoutMs > 0 {
+			spec.TimeoutMs = int(clampTimeout(spec.TimeoutMs, o.RequestTimeout, o.MaxRequestTimeout) / time.Millisecond)
+		}
+		clamped[i] = spec
+	}
+	return clamped, nil
+}
+
+//server-side retry policy overridden by the one requested by the client
+func (o Options) retryPolicy(dto *models.RetryDto) (http_fetcher.RetryPolicy, error) {
+	policy := o.Retry
+	if dto == nil {
+		return policy, nil
+	}
+	if dto.MaxAttempts > 0 {
+		policy.MaxAttempts = dto.MaxAttempts
+		if policy.MaxAttempts > o.MaxRetryAttempts {
+			policy.MaxAttempts = o.MaxRetryAttempts
+		}
+	}
+	//delays longer than the fetch timeout are useless, as retries never exceed it
+	if dto.BackoffBaseMs > 0 {
+		policy.BackoffBase = clampTimeout(dto.BackoffBaseMs, policy.BackoffBase, o.MaxFetchTimeout)
+	}
+	if dto.BackoffCapMs > 0 {
+		policy.BackoffCap = clampTimeout(dto.BackoffCapMs, policy.BackoffCap, o.MaxFetchTimeout)
+	}
+	if dto.Jitter != nil {
+		if *dto.Jitter < 0 || *dto.Jitter > 1 {
+			return policy, fmt.Errorf("retry jitter must be in range [0, 1], got %v", *dto.Jitter)
+		}
+		policy.Jitter = *dto.Jitter
+	}
+	if dto.Statuses != nil {
+		policy.RetryStatuses = dto.Statuses
+	}
+	if dto.Errors != nil {
+		for _, class := range dto.Errors {
+			if !isErrorClass(class) {
+				return policy, fmt.Errorf("unknown retry error class %q", class)
+			}
+		}
+		policy.RetryErrors = dto.Errors
+	}
+	return policy, nil
+}
+
+func isErrorClass(class string) bool {
+	for _, known := range http_fetcher.ErrorClasses {
+		if class == known {
+			return true
+		}
+	}
+	return false
+}
+
+//returns value and max, where zeros are replaced with def and value doesn't exceed max
+func defaultInt(value, max, def int) (int, int) {
+	if value <= 0 {
+		value = def
+	}
+	if max <= 0 {
+		max = value
+	}
+	if value > max {
+		value = max
+	}
+	return value, max
+}
+
+//same as defaultInt, but for durations
+func defaultDuration(value, max, def time.Duration) (time.Duration, time.Duration) {
+	if value <= 0 {
+		value = def
+	}
+	if max <= 0 {
+		max = value
+	}
+	if value > max {
+		value = max
+	}
+	return value, max
+}
+
+//converts timeout in milliseconds, requested by client, to a duration in (0, max], def is used if not requested.
+//Values are compared before the conversion, so huge ones can't overflow it
+func clampTimeout(ms int, def, max time.Duration) time.Duration {
+	if ms <= 0 {
+		return def
+	}
+	if int64(ms) > int64(max/time.Millisecond) {
+		return max
+	}
+	return time.Duration(ms) * time.Millisecond
+}
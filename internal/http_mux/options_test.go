@@ -0,0 +1,173 @@
+package http_mux
+
+import (
+	"github.com/quantum0cat/simple-http-mux/internal/http_fetcher"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestOptions_fetchOptions(t *testing.T) {
+
+	opts := Options{
+		MaxWorkers:        8,
+		MaxFetchTimeout:   20 * time.Second,
+		MaxRequestTimeout: 5 * time.Second,
+	}.withDefaults()
+
+	tests := []struct {
+		name    string
+		dto     models.UrlsDto
+		want    http_fetcher.Options
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			dto:  models.UrlsDto{},
+			want: http_fetcher.Options{
+				MaxWorkers:     defaultWorkers,
+				FetchTimeout:   defaultFetchTimeout,
+				RequestTimeout: defaultRequestTimeout,
+			},
+		},
+		{
+			name: "requested",
+			dto: models.UrlsDto{
+				Workers:          6,
+				FetchTimeoutMs:   15000,
+				RequestTimeoutMs: 2000,
+				Method:           http.MethodPost,
+				Body:             "body",
+			},
+			want: http_fetcher.Options{
+				MaxWorkers:     6,
+				FetchTimeout:   15 * time.Second,
+				RequestTimeout: 2 * time.Second,
+				Method:         http.MethodPost,
+				Body:           "body",
+			},
+		},
+		{
+			name: "clamped",
+			dto: models.UrlsDto{
+				Workers:          100,
+				FetchTimeoutMs:   100000,
+				RequestTimeoutMs: 100000,
+			},
+			want: http_fetcher.Options{
+				MaxWorkers:     8,
+				FetchTimeout:   20 * time.Second,
+				RequestTimeout: 5 * time.Second,
+			},
+		},
+		{
+			name: "overflow",
+			dto: models.UrlsDto{
+				FetchTimeoutMs:   1e13,
+				RequestTimeoutMs: 1e13,
+			},
+			want: http_fetcher.Options{
+				MaxWorkers:     defaultWorkers,
+				FetchTimeout:   20 * time.Second,
+				RequestTimeout: 5 * time.Second,
+			},
+		},
+		{
+			name:    "unsupported method",
+			dto:     models.UrlsDto{Method: "CONNECT"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.want.MaxResponseBytes = defaultMaxResponseBytes
+			tt.want.MaxBatchResponseBytes = defaultMaxBatchBytes
+			got, err := opts.fetchOptions(&tt.dto)
+			if tt.wantErr {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, tt.want, got, "options don't match")
+		})
+	}
+}
+
+func TestOptions_retryPolicy(t *testing.T) {
+
+	opts := Options{
+		Retry: http_fetcher.RetryPolicy{
+			MaxAttempts:   2,
+			BackoffBase:   100 * time.Millisecond,
+			RetryStatuses: []int{http.StatusServiceUnavailable},
+		},
+		MaxRetryAttempts: 3,
+	}.withDefaults()
+	jitter := 0.5
+	invalidJitter := 2.0
+
+	tests := []struct {
+		name    string
+		dto     *models.RetryDto
+		want    http_fetcher.RetryPolicy
+		wantErr bool
+	}{
+		{
+			name: "server-side",
+			dto:  nil,
+			want: opts.Retry,
+		},
+		{
+			name: "overridden and clamped",
+			dto: &models.RetryDto{
+				MaxAttempts:   10,
+				BackoffBaseMs: 10,
+				Jitter:        &jitter,
+				Errors:        []string{http_fetcher.ErrorClassDns},
+			},
+			want: http_fetcher.RetryPolicy{
+				MaxAttempts:   3,
+				BackoffBase:   10 * time.Millisecond,
+				Jitter:        0.5,
+				RetryStatuses: []int{http.StatusServiceUnavailable},
+				RetryErrors:   []string{http_fetcher.ErrorClassDns},
+			},
+		},
+		{
+			name: "backoff clamped",
+			dto: &models.RetryDto{
+				BackoffBaseMs: 1e13,
+				BackoffCapMs:  1e13,
+			},
+			want: http_fetcher.RetryPolicy{
+				MaxAttempts:   2,
+				BackoffBase:   opts.MaxFetchTimeout,
+				BackoffCap:    opts.MaxFetchTimeout,
+				RetryStatuses: []int{http.StatusServiceUnavailable},
+			},
+		},
+		{
+			name:    "invalid jitter",
+			dto:     &models.RetryDto{Jitter: &invalidJitter},
+			wantErr: true,
+		},
+		{
+			name:    "unknown error class",
+			dto:     &models.RetryDto{Errors: []string{"everything"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := opts.retryPolicy(tt.dto)
+			if tt.wantErr {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, tt.want, got, "policies don't match")
+		})
+	}
+}
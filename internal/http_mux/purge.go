@@ -0,0 +1,64 @@
+package http_mux
+
+import (
+	"encoding/json"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/quantum0cat/simple-http-mux/pkg/urlutil"
+	"net/http"
+)
+
+//removes responses of the listed urls from the cache, or all responses if the request body is empty
+func (h *muxHandler) purgeCache(w http.ResponseWriter, r *http.Request) {
+	rid := requestId(r)
+	opts := h.options()
+	log := h.log.With("rid", rid)
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		sendError(w, rid, ErrCodeMethodNotAllowed, "Only POST method is supported", nil)
+		return
+	}
+	if h.cache == nil {
+		sendError(w, rid, ErrCodeCacheDisabled, "Cache is disabled", nil)
+		return
+	}
+	body, ok := readBody(w, r, opts.MaxRequestBodyBytes, rid)
+	if !ok {
+		return
+	}
+	var dto models.PurgeDto
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &dto); err != nil {
+			sendError(w, rid, ErrCodeInvalidJson, "Incorrect JSON in request body", map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	var result models.PurgeResult
+	if len(dto.Urls) == 0 {
+		result.Purged = h.cache.Purge("")
+	}
+	for _, url := range dto.Urls {
+		if url == "" {
+			continue
+		}
+		//responses are cached by normalized urls, invalid ones are purged as is
+		if normalized, err := urlutil.Normalize(url); err == nil {
+			url = normalized
+		}
+		result.Purged += h.cache.Purge(url)
+	}
+	log.Info("Cache purged", "urls", len(dto.Urls), "purged", result.Purged)
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		sendError(w, rid, ErrCodeInternal, err.Error(), nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(data)
+	if err != nil {
+		log.Warn("Failed to write data to response", "error", err)
+	}
+}
@@ -0,0 +1,53 @@
+package http_mux
+
+import (
+	"bytes"
+	"context"
+	"github.com/quantum0cat/simple-http-mux/internal/cache"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_muxHandler_purgeCache(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		disabled   bool
+		statusCode int
+		wantBody   string
+		wantLeft   int
+	}{
+		{name: "url", method: http.MethodPost, body: `{"urls": ["http://a"]}`, statusCode: http.StatusOK, wantBody: `{"purged":1}`, wantLeft: 1},
+		{name: "all", method: http.MethodPost, statusCode: http.StatusOK, wantBody: `{"purged":2}`, wantLeft: 0},
+		{name: "bad json", method: http.MethodPost, body: `[`, statusCode: http.StatusBadRequest, wantLeft: 2},
+		{name: "method", method: http.MethodGet, statusCode: http.StatusMethodNotAllowed, wantLeft: 2},
+		{name: "disabled", method: http.MethodPost, disabled: true, statusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newMuxHandler(context.Background(), Options{})
+			if !tt.disabled {
+				handler.cache = cache.New(cache.Config{MaxBytes: 1 << 20})
+				for _, url := range []string{"http://a", "http://b"} {
+					resp := models.Response{Url: url, Status: models.StatusOk, StatusCode: http.StatusOK}
+					handler.cache.Store(http.MethodGet, url, nil, http.Header{"Cache-Control": {"max-age=60"}}, resp, nil)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			handler.purgeCache(w, httptest.NewRequest(tt.method, "http://localhost/cache/purge", bytes.NewBufferString(tt.body)))
+			assert.Equal(t, tt.statusCode, w.Code, "status codes don't match")
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, w.Body.String(), "bodies don't match")
+			}
+			if !tt.disabled {
+				assert.Equal(t, tt.wantLeft, handler.cache.Stats().Entries, "cached entries count doesn't match")
+			}
+		})
+	}
+}
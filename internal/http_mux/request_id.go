@@ -0,0 +1,31 @@
+package http_mux
+
+import (
+	"context"
+	"github.com/quantum0cat/simple-http-mux/internal/http_fetcher"
+	"github.com/quantum0cat/simple-http-mux/pkg/utils"
+	"net/http"
+)
+
+type requestIdKey struct{}
+
+//takes the request id from the request header, or generates a new one if it's missing or invalid,
+//puts it into the request context and the response header
+func withRequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rid := r.Header.Get(http_fetcher.RequestIdHeader)
+		if !utils.ValidRequestId(rid) {
+			rid = utils.NewRequestId()
+		}
+		w.Header().Set(http_fetcher.RequestIdHeader, rid)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIdKey{}, rid)))
+	})
+}
+
+//returns the request id set by withRequestId, or a new one if the request didn't pass it
+func requestId(r *http.Request) string {
+	if rid, ok := r.Context().Value(requestIdKey{}).(string); ok {
+		return rid
+	}
+	return utils.NewRequestId()
+}
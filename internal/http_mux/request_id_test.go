@@ -0,0 +1,48 @@
+package http_mux
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/quantum0cat/simple-http-mux/internal/http_fetcher"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_withRequestId(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		header   string
+		wantSame bool
+	}{
+		{name: "passed", header: "client-id-42", wantSame: true},
+		{name: "missing"},
+		{name: "invalid", header: "bad id with spaces"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := NewHttpMux(context.Background(), 10000, 100, Options{}, nil)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "http://localhost/unknown", nil)
+			if tt.header != "" {
+				r.Header.Set(http_fetcher.RequestIdHeader, tt.header)
+			}
+			mux.server.Handler.ServeHTTP(w, r)
+
+			rid := w.Header().Get(http_fetcher.RequestIdHeader)
+			assert.NotEmpty(t, rid, "request id header is missing")
+			if tt.wantSame {
+				assert.Equal(t, tt.header, rid, "request id is not echoed")
+			} else {
+				assert.NotEqual(t, tt.header, rid, "invalid request id is accepted")
+			}
+
+			var dto models.ErrorDto
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &dto), "failed to unmarshal error")
+			assert.Equal(t, rid, dto.RequestId, "request ids of header and body don't match")
+		})
+	}
+}
@@ -1,10 +1,27 @@
 package http_mux
 
 import (
+	"encoding/json"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
 	"net/http"
 )
 
-//aux func to send error to writer
-func sendError(w http.ResponseWriter, message string, statusCode int) {
-	http.Error(w, message, statusCode)
+//aux func to send error to writer as JSON, the status is defined by the error code.
+//rid and details are omitted if empty
+func sendError(w http.ResponseWriter, rid string, code string, message string, details interface{}) {
+	dto := models.ErrorDto{
+		Code:      code,
+		Message:   message,
+		RequestId: rid,
+		Details:   details,
+	}
+	data, err := json.Marshal(dto)
+	if err != nil {
+		http.Error(w, message, errorStatus(code))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(errorStatus(code))
+	_, _ = w.Write(append(data, '\n'))
 }
@@ -15,13 +15,38 @@ func Test_sendError(t *testing.T) {
 
 	tests := []struct {
 		name       string
-		message    string
+		rid        string
+		code       string
+		details    interface{}
 		statusCode int
+		wantBody   string
 	}{
 		{
 			name:       "default",
-			message:    errorMessage,
+			rid:        "7",
+			code:       ErrCodeInternal,
 			statusCode: http.StatusInternalServerError,
+			wantBody:   `{"code":"internal_error","message":"TestErrorMessage!!!","request_id":"7"}`,
+		},
+		{
+			name:       "details without request id",
+			code:       ErrCodeTooManyUrls,
+			details:    map[string]int{"max": 20},
+			statusCode: http.StatusUnprocessableEntity,
+			wantBody:   `{"code":"too_many_urls","message":"TestErrorMessage!!!","details":{"max":20}}`,
+		},
+		{
+			name:       "client closed request",
+			rid:        "req-1",
+			code:       ErrCodeClientClosedRequest,
+			statusCode: statusClientClosedRequest,
+			wantBody:   `{"code":"client_closed_request","message":"TestErrorMessage!!!","request_id":"req-1"}`,
+		},
+		{
+			name:       "unknown code",
+			code:       "unknown",
+			statusCode: http.StatusInternalServerError,
+			wantBody:   `{"code":"unknown","message":"TestErrorMessage!!!"}`,
 		},
 	}
 	for _, tt := range tests {
@@ -29,16 +54,17 @@ func Test_sendError(t *testing.T) {
 
 			w := httptest.NewRecorder()
 
-			sendError(w, tt.message, tt.statusCode)
+			sendError(w, tt.rid, tt.code, errorMessage, tt.details)
 
 			r := w.Result()
 			assert.Equal(t, r.StatusCode, tt.statusCode, "status codes don't match")
+			assert.Equal(t, "application/json; charset=utf-8", r.Header.Get("Content-Type"), "content types don't match")
 
 			defer func() { _ = r.Body.Close() }()
 			body, err := io.ReadAll(r.Body)
 			assert.NoError(t, err, "failed to read response body")
 
-			assert.Equal(t, tt.message+"\n", string(body), "messages don't match")
+			assert.JSONEq(t, tt.wantBody, string(body), "messages don't match")
 
 			fmt.Printf("%s", string(body))
 		})
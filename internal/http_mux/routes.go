@@ -0,0 +1,42 @@
+package http_mux
+
+import (
+	"net/http"
+)
+
+// paths of HttpMux endpoints
+const (
+	PathFetch      = "/v1/fetch"
+	PathCachePurge = "/cache/purge"
+	PathMetrics    = "/metrics"
+	PathHealth     = "/healthz"
+	PathReady      = "/readyz"
+)
+
+//routes requests to the endpoints, unknown paths get 404. Every response carries the request id header,
+//every request is recorded in the access log if it's enabled
+func (h *HttpMux) routes() http.Handler {
+	fetch := h.metrics.instrument("fetch", h.handler)
+	notFound := h.metrics.instrument("not_found", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sendError(w, requestId(r), ErrCodeNotFound, "Not found", map[string]string{"path": r.URL.Path})
+	}))
+
+	routes := http.NewServeMux()
+	routes.Handle(PathFetch, fetch)
+	routes.Handle(PathCachePurge, h.metrics.instrument("purge", http.HandlerFunc(h.handler.purgeCache)))
+	routes.Handle(PathMetrics, h.metrics.instrument("metrics", h.metrics.handler()))
+	routes.HandleFunc(PathHealth, h.healthz)
+	routes.HandleFunc(PathReady, h.readyz)
+	//the root path is the fetch API of old clients, it's served only if enabled
+	routes.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" && h.handler.options().LegacyRootFetch {
+			fetch.ServeHTTP(w, r)
+			return
+		}
+		notFound.ServeHTTP(w, r)
+	}))
+	if h.accessLog == nil {
+		return withRequestId(routes)
+	}
+	return withRequestId(h.accessLog.middleware(routes))
+}
@@ -0,0 +1,38 @@
+package http_mux
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHttpMux_routes(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		legacy     bool
+		method     string
+		path       string
+		statusCode int
+	}{
+		//GET requests are rejected by the fetch API, but not with 404
+		{name: "fetch", method: http.MethodGet, path: PathFetch, statusCode: http.StatusMethodNotAllowed},
+		{name: "legacy root", legacy: true, method: http.MethodGet, path: "/", statusCode: http.StatusMethodNotAllowed},
+		{name: "legacy root disabled", method: http.MethodGet, path: "/", statusCode: http.StatusNotFound},
+		{name: "unknown path", legacy: true, method: http.MethodPost, path: "/favicon.ico", statusCode: http.StatusNotFound},
+		{name: "fetch subpath", method: http.MethodPost, path: PathFetch + "/x", statusCode: http.StatusNotFound},
+		{name: "metrics", method: http.MethodGet, path: PathMetrics, statusCode: http.StatusOK},
+		{name: "purge", method: http.MethodGet, path: PathCachePurge, statusCode: http.StatusMethodNotAllowed},
+		{name: "health", method: http.MethodGet, path: PathHealth, statusCode: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := NewHttpMux(context.Background(), 10000, 100, Options{LegacyRootFetch: tt.legacy}, nil)
+			w := httptest.NewRecorder()
+			mux.server.Handler.ServeHTTP(w, httptest.NewRequest(tt.method, "http://localhost"+tt.path, nil))
+			assert.Equal(t, tt.statusCode, w.Code, "status codes don't match")
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package http_mux
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/quantum0cat/simple-http-mux/pkg/logging"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	contentTypeNdjson = "application/x-ndjson"
+	contentTypeSse    = "text/event-stream"
+)
+
+//picks a streaming content type accepted by the client, empty if the client wants a plain JSON array
+func streamContentType(r *http.Request) string {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		if mediaType == contentTypeNdjson || mediaType == contentTypeSse {
+			return mediaType
+		}
+	}
+	return ""
+}
+
+//writes records one by one as NDJSON lines or SSE events, every record is flushed to the client immediately
+type resultStream struct {
+	w           http.ResponseWriter
+	flusher     http.Flusher
+	contentType string
+	err         error //first write error, nothing is written after it
+}
+
+func newResultStream(w http.ResponseWriter, contentType string) *resultStream {
+	flusher, _ := w.(http.Flusher)
+	return &resultStream{
+		w:           w,
+		flusher:     flusher,
+		contentType: contentType,
+	}
+}
+
+//sends headers, the status can't be changed after it
+func (s *resultStream) start() {
+	s.w.Header().Set("Content-Type", s.contentType+"; charset=utf-8")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.WriteHeader(http.StatusOK)
+	s.flush()
+}
+
+//writes a single record, event is the SSE event name
+func (s *resultStream) write(event string, record interface{}) error {
+	if s.err != nil {
+		return s.err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if s.contentType == contentTypeSse {
+		_, s.err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data)
+	} else {
+		_, s.err = fmt.Fprintf(s.w, "%s\n", data)
+	}
+	s.flush()
+	return s.err
+}
+
+func (s *resultStream) flush() {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+//streams responses as soon as they are fetched, finishing with a summary record
+func (h *muxHandler) streamResults(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	fetcher Fetcher,
+	contentType string,
+	log *logging.Logger,
+) {
+	//stop fetching if the response can't be written
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stats := requestStats(r)
+	stream := newResultStream(w, contentType)
+	stream.start()
+
+	started := time.Now()
+	summary := models.NewSummary()
+	err := fetcher.FetchEach(ctx, func(resp models.Response) {
+		summary.Add(&resp)
+		stats.add(&resp)
+		if err := stream.write("result", resp); err != nil {
+			cancel()
+		}
+	})
+	if err != nil {
+		summary.Error = err.Error()
+		summary.ErrorCode = h.fetchErrorCode(r, err)
+		if summary.ErrorCode == ErrCodeUpstreamFailed {
+			stats.addFailure()
+		}
+		log.Warn("Fetch failed", "code", summary.ErrorCode, "error", err)
+	}
+	summary.DurationMs = float64(time.Since(started)) / float64(time.Millisecond)
+
+	if err = stream.write("summary", summary); err != nil {
+		log.Warn("Failed to write data to response", "error", err)
+	}
+}
@@ -0,0 +1,90 @@
+package http_mux
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/quantum0cat/simple-http-mux/internal/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_streamContentType(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{name: "json", accept: "application/json", want: ""},
+		{name: "ndjson", accept: "application/x-ndjson", want: contentTypeNdjson},
+		{name: "sse", accept: "text/html, text/event-stream;q=0.9", want: contentTypeSse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "http://localhost", nil)
+			r.Header.Set("Accept", tt.accept)
+			assert.Equal(t, tt.want, streamContentType(r), "content types don't match")
+		})
+	}
+}
+
+func Test_muxHandler_stream(t *testing.T) {
+
+	urls := make([]string, 3)
+	for i := range urls {
+		urls[i] = httptest.NewServer(http.HandlerFunc(generateHandlerFunc(i))).URL
+	}
+	dto := models.UrlsDto{Urls: models.NewUrlSpecs(urls)}
+	handler := newMuxHandler(context.Background(), Options{})
+
+	tests := []struct {
+		name        string
+		contentType string
+		prefix      string
+	}{
+		{name: "ndjson", contentType: contentTypeNdjson, prefix: ""},
+		{name: "sse", contentType: contentTypeSse, prefix: "data: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "http://localhost", bytes.NewBuffer(dto.Marshal()))
+			r.Header.Set("Accept", tt.contentType)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusOK, w.Code, "status codes don't match")
+			assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), tt.contentType), "content type doesn't match")
+
+			//collect data records, the last one is a summary
+			var records []string
+			scanner := bufio.NewScanner(w.Body)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if line != "" && strings.HasPrefix(line, tt.prefix) {
+					records = append(records, strings.TrimPrefix(line, tt.prefix))
+				}
+			}
+			assert.Len(t, records, len(urls)+1, "one record per url and a summary expected")
+
+			indices := map[int]struct{}{}
+			for _, record := range records[:len(urls)] {
+				var resp models.Response
+				assert.NoError(t, json.Unmarshal([]byte(record), &resp), "failed to parse response")
+				assert.Equal(t, fmt.Sprintf(testServerResponseFormatIdx, resp.Index), resp.Response, "responses don't match")
+				indices[resp.Index] = struct{}{}
+			}
+			assert.Len(t, indices, len(urls), "every url must be streamed once")
+
+			var summary models.Summary
+			assert.NoError(t, json.Unmarshal([]byte(records[len(urls)]), &summary), "failed to parse summary")
+			assert.Equal(t, "summary", summary.Type, "summary type doesn't match")
+			assert.Equal(t, len(urls), summary.Statuses[models.StatusOk], "statuses don't match")
+		})
+	}
+}
@@ -0,0 +1,360 @@
+/*
+	The package implements metrics in Prometheus text exposition format with the standard library only.
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets
+//upper bounds of histogram buckets for latencies in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric types
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Sample
+//single value of a metric, which is collected on demand
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type metric interface {
+	describe() (name, help, kind string)
+	write(w io.Writer)
+}
+
+// Registry
+//set of metrics, which are written together, safe for concurrent use
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Counter
+//registers a counter with the given label names
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(name, help, labels)}
+	r.register(c)
+	return c
+}
+
+// Gauge
+//registers a gauge with the given label names
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec: newVec(name, help, labels)}
+	r.register(g)
+	return g
+}
+
+// Histogram
+//registers a histogram with the given bucket upper bounds and label names
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{vec: newVec(name, help, labels), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+// Func
+//registers a metric of the given type, which samples are collected by fn on every write
+func (r *Registry) Func(name, help, kind string, labels []string, fn func() []Sample) {
+	r.register(&funcMetric{name: name, help: help, kind: kind, labels: labels, fn: fn})
+}
+
+// WriteTo
+//writes all metrics in text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	counter := &countingWriter{w: bufio.NewWriter(w)}
+	for _, m := range metrics {
+		name, help, kind := m.describe()
+		_, _ = fmt.Fprintf(counter, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind)
+		m.write(counter)
+	}
+	if counter.err == nil {
+		counter.err = counter.w.(*bufio.Writer).Flush()
+	}
+	return counter.n, counter.err
+}
+
+// Handler
+//serves metrics in text exposition format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			http.Error(w, "Only GET method is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = r.WriteTo(w)
+	})
+}
+
+//values of a metric by label values
+type vec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64 //histograms only, counts per bucket (not cumulative)
+	count       uint64   //histograms only
+}
+
+func newVec(name, help string, labels []string) vec {
+	return vec{name: name, help: help, labels: labels, series: map[string]*series{}}
+}
+
+//returns the series for label values, creates it if needed, must be called with mu locked
+func (v *vec) get(labelValues []string, buckets int) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if buckets > 0 {
+			s.buckets = make([]uint64, buckets)
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+//series sorted by label values, must be called with mu locked
+func (v *vec) sorted() []*series {
+	sorted := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		sorted = append(sorted, s)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return strings.Join(sorted[i].labelValues, "\xff") < strings.Join(sorted[j].labelValues, "\xff")
+	})
+	return sorted
+}
+
+// CounterVec
+//counter, partitioned by label values
+type CounterVec struct {
+	vec
+}
+
+// Add
+//increases the counter with the given label values by delta, which must not be negative
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.mu.Lock()
+	c.get(labelValues, 0).value += delta
+	c.mu.Unlock()
+}
+
+// Inc
+//increases the counter with the given label values by 1
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) describe() (string, string, string) {
+	return c.name, c.help, TypeCounter
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.sorted() {
+		writeSample(w, c.name, c.labels, s.labelValues, s.value)
+	}
+}
+
+// GaugeVec
+//gauge, partitioned by label values
+type GaugeVec struct {
+	vec
+}
+
+// Add
+//changes the gauge with the given label values by delta
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues, 0).value += delta
+	g.mu.Unlock()
+}
+
+// Set
+//sets the gauge with the given label values
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues, 0).value = value
+	g.mu.Unlock()
+}
+
+func (g *GaugeVec) describe() (string, string, string) {
+	return g.name, g.help, TypeGauge
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, s := range g.sorted() {
+		writeSample(w, g.name, g.labels, s.labelValues, s.value)
+	}
+}
+
+// HistogramVec
+//histogram, partitioned by label values
+type HistogramVec struct {
+	vec
+	buckets []float64 //sorted upper bounds, +Inf is implied
+}
+
+// Observe
+//adds the value to the histogram with the given label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(labelValues, len(h.buckets))
+	s.value += value
+	s.count++
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.buckets[i]++
+	}
+}
+
+func (h *HistogramVec) describe() (string, string, string) {
+	return h.name, h.help, TypeHistogram
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	labels := withLabel(h.labels, "le")
+	for _, s := range h.sorted() {
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.buckets[i]
+			writeSample(w, h.name+"_bucket", labels, withLabel(s.labelValues, formatFloat(bound)), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", labels, withLabel(s.labelValues, "+Inf"), float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.labelValues, s.value)
+		writeSample(w, h.name+"_count", h.labels, s.labelValues, float64(s.count))
+	}
+}
+
+//copies label values with one more value
+func withLabel(labelValues []string, value string) []string {
+	return append(append(make([]string, 0, len(labelValues)+1), labelValues...), value)
+}
+
+type funcMetric struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	fn     func() []Sample
+}
+
+func (f *funcMetric) describe() (string, string, string) {
+	return f.name, f.help, f.kind
+}
+
+func (f *funcMetric) write(w io.Writer) {
+	samples := f.fn()
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].LabelValues, "\xff") < strings.Join(samples[j].LabelValues, "\xff")
+	})
+	for _, s := range samples {
+		writeSample(w, f.name, f.labels, s.LabelValues, s.Value)
+	}
+}
+
+func writeSample(w io.Writer, name string, labels, labelValues []string, value float64) {
+	var line strings.Builder
+	line.WriteString(name)
+	if len(labels) > 0 {
+		line.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			_, _ = fmt.Fprintf(&line, `%s="%s"`, label, escapeLabelValue(labelValues[i]))
+		}
+		line.WriteByte('}')
+	}
+	line.WriteByte(' ')
+	line.WriteString(formatFloat(value))
+	line.WriteByte('\n')
+	_, _ = io.WriteString(w, line.String())
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+//counts written bytes and keeps the first error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		register func(r *Registry)
+		want     string
+	}{
+		{
+			name: "counter",
+			register: func(r *Registry) {
+				c := r.Counter("requests_total", "Requests.", "code")
+				c.Inc("500")
+				c.Add(2, "200")
+			},
+			want: "# HELP requests_total Requests.\n# TYPE requests_total counter\n" +
+				"requests_total{code=\"200\"} 2\nrequests_total{code=\"500\"} 1\n",
+		},
+		{
+			name: "gauge without labels",
+			register: func(r *Registry) {
+				g := r.Gauge("workers", "Workers.")
+				g.Add(3)
+				g.Add(-1)
+			},
+			want: "# HELP workers Workers.\n# TYPE workers gauge\nworkers 2\n",
+		},
+		{
+			name: "histogram",
+			register: func(r *Registry) {
+				h := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "host")
+				h.Observe(0.05, "a")
+				h.Observe(0.5, "a")
+				h.Observe(5, "a")
+			},
+			want: "# HELP latency_seconds Latency.\n# TYPE latency_seconds histogram\n" +
+				"latency_seconds_bucket{host=\"a\",le=\"0.1\"} 1\n" +
+				"latency_seconds_bucket{host=\"a\",le=\"1\"} 2\n" +
+				"latency_seconds_bucket{host=\"a\",le=\"+Inf\"} 3\n" +
+				"latency_seconds_sum{host=\"a\"} 5.55\n" +
+				"latency_seconds_count{host=\"a\"} 3\n",
+		},
+		{
+			name: "func with escaped labels",
+			register: func(r *Registry) {
+				r.Func("conns", "Connections\nper host.", TypeGauge, []string{"host"}, func() []Sample {
+					return []Sample{{LabelValues: []string{"b\"\\"}, Value: 1}, {LabelValues: []string{"a"}, Value: 2}}
+				})
+			},
+			want: "# HELP conns Connections\\nper host.\n# TYPE conns gauge\n" +
+				"conns{host=\"a\"} 2\nconns{host=\"b\\\"\\\\\"} 1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			tt.register(r)
+			var buf bytes.Buffer
+			n, err := r.WriteTo(&buf)
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, int64(buf.Len()), n, "written bytes count doesn't match")
+			assert.Equal(t, tt.want, buf.String(), "outputs don't match")
+		})
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+
+	r := NewRegistry()
+	r.Counter("requests_total", "Requests.").Inc()
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://localhost/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "status codes don't match")
+	assert.Contains(t, w.Header().Get("Content-Type"), "version=0.0.4", "content type doesn't match")
+	assert.Contains(t, w.Body.String(), "requests_total 1\n", "metric is missing")
+
+	w = httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://localhost/metrics", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code, "status codes don't match")
+}
@@ -1,9 +1,98 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+)
+
+// statuses of a single url fetch
+const (
+	StatusOk        = "ok"
+	StatusError     = "error"
+	StatusTimeout   = "timeout"
+	StatusCancelled = "cancelled"
+	StatusBlocked   = "blocked" //destination address is not allowed
+)
+
+// encodings of the response body in Response
+const (
+	EncodingText   = "text"   //body is in Response.Response
+	EncodingBase64 = "base64" //body is in Response.ResponseBase64
+	EncodingJson   = "json"   //body is in Response.Json
+)
 
 type UrlsDto struct {
-	Urls []string `json:"urls"`
+	Urls []UrlSpec `json:"urls"`
+	//abort the whole request on the first failed url instead of reporting per-url results
+	FailFast bool `json:"fail_fast,omitempty"`
+	//optional fetch settings, clamped by server-side limits
+	RequestTimeoutMs int               `json:"request_timeout_ms,omitempty"` //timeout for a single url
+	FetchTimeoutMs   int               `json:"fetch_timeout_ms,omitempty"`   //timeout to fetch all urls
+	Workers          int               `json:"workers,omitempty"`            //fetch workers count
+	Method           string            `json:"method,omitempty"`             //HTTP method of upstream requests
+	Headers          map[string]string `json:"headers,omitempty"`            //headers of upstream requests
+	Body             string            `json:"body,omitempty"`               //body of upstream requests
+	FailOnTruncate   bool              `json:"fail_on_truncate,omitempty"`   //fail urls exceeding size limits instead of truncation
+	DecodeJson       bool              `json:"decode_json,omitempty"`        //embed JSON upstream bodies as JSON instead of a string
+	Retry            *RetryDto         `json:"retry,omitempty"`              //retry policy of failed urls
+	NoCache          bool              `json:"no_cache,omitempty"`           //revalidate cached responses with upstream
+}
+
+// RetryDto
+//retry policy requested by the client, missing fields are taken from the server-side policy
+type RetryDto struct {
+	MaxAttempts   int      `json:"max_attempts,omitempty"` //attempts count including the first one
+	BackoffBaseMs int      `json:"backoff_base_ms,omitempty"`
+	BackoffCapMs  int      `json:"backoff_cap_ms,omitempty"`
+	Jitter        *float64 `json:"jitter,omitempty"`   //random deviation of the delay in [0, 1]
+	Statuses      []int    `json:"statuses,omitempty"` //upstream statuses to retry
+	Errors        []string `json:"errors,omitempty"`   //error classes to retry: timeout, connection, dns
+}
+
+// UrlSpec
+//single url to fetch, in JSON it's either a url string or an object with request settings,
+//which take precedence over the fetch-wide ones
+type UrlSpec struct {
+	Url       string            `json:"url"`
+	Method    string            `json:"method,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      string            `json:"body,omitempty"`
+	TimeoutMs int               `json:"timeout_ms,omitempty"`
+	Id        json.RawMessage   `json:"id,omitempty"` //client id, echoed back in Response
+}
+
+// NewUrlSpecs
+//makes url specs for plain urls list
+func NewUrlSpecs(urls []string) []UrlSpec {
+	specs := make([]UrlSpec, len(urls))
+	for i, url := range urls {
+		specs[i] = UrlSpec{Url: url}
+	}
+	return specs
+}
+
+func (u *UrlSpec) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*u = UrlSpec{Url: url}
+		return nil
+	}
+	//avoid recursion into this method
+	type urlSpec UrlSpec
+	var spec urlSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return errors.New("url must be either a string or an object")
+	}
+	*u = UrlSpec(spec)
+	return nil
+}
+
+func (u UrlSpec) MarshalJSON() ([]byte, error) {
+	if u.Method == "" && len(u.Headers) == 0 && u.Body == "" && u.TimeoutMs == 0 && len(u.Id) == 0 {
+		return json.Marshal(u.Url)
+	}
+	type urlSpec UrlSpec
+	return json.Marshal(urlSpec(u))
 }
 
 func (u *UrlsDto) Marshal() []byte {
@@ -15,6 +104,99 @@ func (u *UrlsDto) Marshal() []byte {
 }
 
 type Response struct {
-	Url      string `json:"url"`
-	Response string `json:"response"`
+	Index          int               `json:"index"`        //position of the url in the request
+	Id             json.RawMessage   `json:"id,omitempty"` //client id of the url
+	Url            string            `json:"url"`
+	Status         string            `json:"status"`
+	StatusCode     int               `json:"status_code,omitempty"` //upstream HTTP status
+	Error          string            `json:"error,omitempty"`
+	Attempts       int               `json:"attempts,omitempty"`  //fetch attempts count including retries
+	CacheHit       bool              `json:"cache_hit,omitempty"` //response was served from the cache
+	Coalesced      bool              `json:"coalesced,omitempty"` //upstream request was shared with concurrent requests
+	ContentType    string            `json:"content_type,omitempty"`
+	ContentLength  int64             `json:"content_length,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"` //selected upstream headers
+	Timing         *Timing           `json:"timing,omitempty"`
+	Truncated      bool              `json:"truncated,omitempty"` //response body was cut at the size limit
+	Encoding       string            `json:"encoding,omitempty"`  //tells which field holds the response body
+	Response       string            `json:"response"`
+	ResponseBase64 string            `json:"response_base64,omitempty"`
+	Json           json.RawMessage   `json:"response_json,omitempty"`
+}
+
+// Timing
+//breakdown of a single url fetch in milliseconds, phases which didn't happen are zero
+type Timing struct {
+	DNS     float64 `json:"dns_ms"`
+	Connect float64 `json:"connect_ms"`
+	TLS     float64 `json:"tls_ms"`
+	TTFB    float64 `json:"ttfb_ms"` //time to first response byte
+	Total   float64 `json:"total_ms"`
+}
+
+// ErrorDto
+//error response of the API
+type ErrorDto struct {
+	Code      string      `json:"code"` //stable error code, e.g. "too_many_urls"
+	Message   string      `json:"message"`
+	RequestId string      `json:"request_id,omitempty"`
+	Details   interface{} `json:"details,omitempty"` //code-specific details
+}
+
+// PurgeDto
+//urls to remove from the cache, all cached responses are removed if it's empty
+type PurgeDto struct {
+	Urls []string `json:"urls,omitempty"`
+}
+
+// InvalidUrl
+//url of the request, which can't be fetched, and the reason
+type InvalidUrl struct {
+	Index  int    `json:"index"` //position of the url in the request
+	Url    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// PurgeResult
+//result of the cache purge
+type PurgeResult struct {
+	Purged int `json:"purged"` //count of removed responses
+}
+
+// statuses of health probes
+const (
+	HealthOk       = "ok"
+	HealthDraining = "draining" //shutdown is in progress, new requests should go elsewhere
+	HealthDown     = "down"     //server is not serving
+)
+
+// Health
+//result of a health probe
+type Health struct {
+	Status string `json:"status"`
+}
+
+// Summary
+//final record of a streamed response
+type Summary struct {
+	Type       string         `json:"type"` //always "summary", tells the record apart from responses
+	Total      int            `json:"total"`
+	Statuses   map[string]int `json:"statuses"` //responses count by status
+	DurationMs float64        `json:"duration_ms"`
+	Error      string         `json:"error,omitempty"`      //error, which interrupted the fetch
+	ErrorCode  string         `json:"error_code,omitempty"` //API error code of the error
+}
+
+func NewSummary() *Summary {
+	return &Summary{
+		Type:     "summary",
+		Statuses: map[string]int{},
+	}
+}
+
+// Add
+//counts the response in the summary
+func (s *Summary) Add(resp *Response) {
+	s.Total++
+	s.Statuses[resp.Status]++
 }
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUrlSpec_UnmarshalJSON(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		data    string
+		want    UrlSpec
+		wantErr bool
+	}{
+		{
+			name: "string",
+			data: `"http://localhost"`,
+			want: UrlSpec{Url: "http://localhost"},
+		},
+		{
+			name: "object",
+			data: `{"url":"http://localhost","method":"POST","headers":{"X-Test":"test"},"body":"body","timeout_ms":100,"id":1}`,
+			want: UrlSpec{
+				Url:       "http://localhost",
+				Method:    "POST",
+				Headers:   map[string]string{"X-Test": "test"},
+				Body:      "body",
+				TimeoutMs: 100,
+				Id:        json.RawMessage(`1`),
+			},
+		},
+		{
+			name:    "failing",
+			data:    `1`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spec UrlSpec
+			err := json.Unmarshal([]byte(tt.data), &spec)
+			if tt.wantErr {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+			assert.NoError(t, err, "failed to unmarshal")
+			assert.Equal(t, tt.want, spec, "specs don't match")
+
+			//marshalling back gives the same JSON
+			data, err := json.Marshal(spec)
+			assert.NoError(t, err, "failed to marshal")
+			assert.JSONEq(t, tt.data, string(data), "JSONs don't match")
+		})
+	}
+}
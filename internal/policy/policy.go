@@ -0,0 +1,136 @@
+/*
+	The package implements policies, which restrict urls to fetch by scheme, host and port.
+*/
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrDenied
+//the url is not allowed by the policy
+var ErrDenied = errors.New("url is denied by policy")
+
+// DefaultSchemes
+//schemes, which are allowed if Policy.Schemes is empty
+var DefaultSchemes = []string{"http", "https"}
+
+//ports of schemes, which are used if the url has no port
+var defaultPorts = map[string]int{"http": 80, "https": 443}
+
+// Policy
+//restricts urls to fetch, zero value allows http and https urls of any host and port.
+//Host patterns are host names ("example.com"), domains with subdomains (".example.com")
+//or globs ("*.example.com", "api-?.example.com"), they are case-insensitive
+type Policy struct {
+	Schemes    []string //allowed schemes, DefaultSchemes if empty
+	AllowHosts []string //patterns of allowed hosts, all hosts if empty
+	DenyHosts  []string //patterns of denied hosts, take precedence over AllowHosts
+	Ports      []int    //allowed ports, all ports if empty, the default port of the scheme is used if the url has none
+}
+
+// Check
+//returns an error wrapping ErrDenied if the url is not allowed
+func (p *Policy) Check(u *url.URL) error {
+	scheme := strings.ToLower(u.Scheme)
+	schemes := p.Schemes
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+	if !containsFold(schemes, scheme) {
+		return fmt.Errorf("%w: scheme %q is not allowed", ErrDenied, u.Scheme)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return fmt.Errorf("%w: host is empty", ErrDenied)
+	}
+	if matchAny(p.DenyHosts, host) {
+		return fmt.Errorf("%w: host %q is denied", ErrDenied, host)
+	}
+	if len(p.AllowHosts) > 0 && !matchAny(p.AllowHosts, host) {
+		return fmt.Errorf("%w: host %q is not allowed", ErrDenied, host)
+	}
+
+	if len(p.Ports) > 0 {
+		port, ok := defaultPorts[scheme]
+		if u.Port() != "" {
+			var err error
+			port, err = strconv.Atoi(u.Port())
+			ok = err == nil
+		}
+		if !ok || !containsPort(p.Ports, port) {
+			return fmt.Errorf("%w: port of %q is not allowed", ErrDenied, u.Host)
+		}
+	}
+	return nil
+}
+
+// Validate
+//checks the policy, all found problems are reported in a single error
+func (p *Policy) Validate() error {
+	var problems []string
+	for _, scheme := range p.Schemes {
+		if scheme == "" || strings.ContainsAny(scheme, ":/ ") {
+			problems = append(problems, fmt.Sprintf("invalid scheme %q", scheme))
+		}
+	}
+	for _, pattern := range append(append([]string{}, p.AllowHosts...), p.DenyHosts...) {
+		if _, err := path.Match(strings.ToLower(pattern), ""); err != nil || strings.Trim(pattern, ".") == "" {
+			problems = append(problems, fmt.Sprintf("invalid host pattern %q", pattern))
+		}
+	}
+	for _, port := range p.Ports {
+		if port <= 0 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("invalid port %d", port))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+//tells whether the host matches one of the patterns, host must be in lower case
+func matchAny(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+		switch {
+		case strings.HasPrefix(pattern, "."):
+			if host == pattern[1:] || strings.HasSuffix(host, pattern) {
+				return true
+			}
+		case strings.ContainsAny(pattern, "*?["):
+			//invalid patterns never match, they are reported by Validate
+			if matched, _ := path.Match(pattern, host); matched {
+				return true
+			}
+		case host == pattern:
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, item string) bool {
+	for _, known := range list {
+		if strings.EqualFold(known, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPort(ports []int, port int) bool {
+	for _, known := range ports {
+		if known == port {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestPolicy_Check(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		url       string
+		wantError bool
+	}{
+		{name: "default http", url: "http://example.com/a"},
+		{name: "default https", url: "HTTPS://Example.com/a"},
+		{name: "default ftp", url: "ftp://example.com/a", wantError: true},
+		{name: "default file", url: "file:///etc/passwd", wantError: true},
+		{name: "no scheme", url: "example.com", wantError: true},
+		{name: "custom scheme", policy: Policy{Schemes: []string{"https"}}, url: "http://example.com", wantError: true},
+		{name: "allowed host", policy: Policy{AllowHosts: []string{"example.com"}}, url: "http://EXAMPLE.com./"},
+		{name: "not allowed host", policy: Policy{AllowHosts: []string{"example.com"}}, url: "http://api.example.com", wantError: true},
+		{name: "allowed domain", policy: Policy{AllowHosts: []string{".example.com"}}, url: "http://a.b.example.com"},
+		{name: "allowed domain itself", policy: Policy{AllowHosts: []string{".example.com"}}, url: "http://example.com"},
+		{name: "domain suffix only", policy: Policy{AllowHosts: []string{".example.com"}}, url: "http://badexample.com", wantError: true},
+		{name: "allowed glob", policy: Policy{AllowHosts: []string{"api-?.example.*"}}, url: "http://api-1.example.org"},
+		{
+			name:      "denied host takes precedence",
+			policy:    Policy{AllowHosts: []string{".example.com"}, DenyHosts: []string{"admin.example.com"}},
+			url:       "http://admin.example.com",
+			wantError: true,
+		},
+		{name: "denied ip", policy: Policy{DenyHosts: []string{"::1"}}, url: "http://[::1]:8080", wantError: true},
+		{name: "allowed default port", policy: Policy{Ports: []int{443}}, url: "https://example.com"},
+		{name: "allowed explicit port", policy: Policy{Ports: []int{80, 8080}}, url: "http://example.com:8080"},
+		{name: "not allowed port", policy: Policy{Ports: []int{80, 443}}, url: "http://example.com:22", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			assert.NoError(t, err, "failed to parse url")
+			err = tt.policy.Check(u)
+			if tt.wantError {
+				assert.True(t, errors.Is(err, ErrDenied), "expected ErrDenied, got %v", err)
+			} else {
+				assert.NoError(t, err, "unexpected error")
+			}
+		})
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+
+	valid := Policy{Schemes: []string{"https"}, AllowHosts: []string{".example.com", "*.test"}, Ports: []int{443}}
+	assert.NoError(t, valid.Validate(), "unexpected error")
+
+	invalid := Policy{Schemes: []string{"https://"}, DenyHosts: []string{"[a-", "."}, Ports: []int{0}}
+	assert.Error(t, invalid.Validate(), "expected an error")
+}
@@ -0,0 +1,113 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// ErrBlocked
+//connection to a non-public address was refused by the guard
+var ErrBlocked = errors.New("destination address is blocked")
+
+//non-public networks, which are not recognized by net.IP methods
+var reservedNetworks = mustParseNetworks(
+	"0.0.0.0/8",       //"this" network
+	"100.64.0.0/10",   //carrier-grade NAT
+	"192.0.0.0/24",    //IETF protocol assignments
+	"192.0.2.0/24",    //documentation
+	"198.18.0.0/15",   //benchmarking
+	"198.51.100.0/24", //documentation
+	"203.0.113.0/24",  //documentation
+	"240.0.0.0/4",     //reserved, including broadcast
+	"2001:db8::/32",   //documentation
+	"64:ff9b:1::/48",  //local-use NAT64
+)
+
+//IPv6 prefixes, which embed an IPv4 address
+var (
+	nat64Network = mustParseNetworks("64:ff9b::/96")[0] //well-known NAT64 prefix, IPv4 address in the last 4 bytes
+	sixToFour    = mustParseNetworks("2002::/16")[0]    //6to4, IPv4 address in bytes 2-5
+)
+
+// ParseNetworks
+//parses CIDR notations, e.g. "10.0.0.0/8"
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func mustParseNetworks(cidrs ...string) []*net.IPNet {
+	networks, err := ParseNetworks(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return networks
+}
+
+// Public
+//tells whether the address is public: not private, loopback, link-local, multicast, unspecified or reserved.
+//IPv6 addresses of NAT64 and 6to4 are public only if the embedded IPv4 address is
+func Public(ip net.IP) bool {
+	if embedded := embeddedIPv4(ip); embedded != nil {
+		return Public(embedded)
+	}
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	return !contains(reservedNetworks, ip)
+}
+
+//returns IPv4 address, which is embedded into NAT64 or 6to4 address, nil for other addresses
+func embeddedIPv4(ip net.IP) net.IP {
+	if ip.To4() != nil {
+		return nil
+	}
+	switch {
+	case nat64Network.Contains(ip):
+		return net.IPv4(ip[12], ip[13], ip[14], ip[15])
+	case sixToFour.Contains(ip):
+		return net.IPv4(ip[2], ip[3], ip[4], ip[5])
+	}
+	return nil
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//refuses connections to non-public addresses except the allowed networks
+type guard struct {
+	allowed []*net.IPNet
+}
+
+//checks the address of every connection right before it's established, i.e. after the host name is resolved,
+//so the check can't be bypassed by DNS rebinding
+func (g *guard) control(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlocked, err.Error())
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: %s is not an IP address", ErrBlocked, host)
+	}
+	if Public(ip) || contains(g.allowed, ip) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is not a public address", ErrBlocked, ip)
+}
@@ -0,0 +1,77 @@
+package transport
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublic(t *testing.T) {
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "8.8.8.8", want: true},
+		{ip: "2606:4700:4700::1111", want: true},
+		{ip: "127.0.0.1"},
+		{ip: "10.1.2.3"},
+		{ip: "172.16.0.1"},
+		{ip: "192.168.1.1"},
+		{ip: "169.254.169.254"},
+		{ip: "100.64.0.1"},
+		{ip: "0.0.0.0"},
+		{ip: "224.0.0.1"},
+		{ip: "255.255.255.255"},
+		{ip: "::1"},
+		{ip: "fe80::1"},
+		{ip: "fc00::1"},
+		{ip: "::ffff:10.0.0.1"},
+		{ip: "64:ff9b::a9fe:a9fe"},
+		{ip: "64:ff9b::808:808", want: true},
+		{ip: "64:ff9b:1::a01:203"},
+		{ip: "2002:a9fe:a9fe::1"},
+		{ip: "2002:7f00:1::"},
+		{ip: "2002:808:808::1", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.want, Public(net.ParseIP(tt.ip)), "results don't match")
+		})
+	}
+}
+
+func TestTransport_guard(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer testServer.Close()
+	loopback, err := ParseNetworks([]string{"127.0.0.0/8"})
+	assert.NoError(t, err, "failed to parse networks")
+
+	tests := []struct {
+		name        string
+		cfg         Config
+		wantBlocked bool
+	}{
+		{name: "guard disabled", cfg: Config{}},
+		{name: "loopback blocked", cfg: Config{BlockPrivateNetworks: true}, wantBlocked: true},
+		{name: "loopback allowed", cfg: Config{BlockPrivateNetworks: true, AllowedNetworks: loopback}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := http.Client{Transport: New(tt.cfg)}
+			resp, err := client.Get(testServer.URL)
+			if tt.wantBlocked {
+				assert.True(t, errors.Is(err, ErrBlocked), "expected ErrBlocked, got %v", err)
+				return
+			}
+			if assert.NoError(t, err, "unexpected error") {
+				_ = resp.Body.Close()
+			}
+		})
+	}
+}
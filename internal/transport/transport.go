@@ -0,0 +1,196 @@
+/*
+	The package implements a shared HTTP transport for upstream requests with a tuned connection pool and its statistics.
+*/
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config
+//transport settings, zero values are replaced with defaults
+type Config struct {
+	MaxIdleConns        int           //max idle connections to all hosts
+	MaxIdleConnsPerHost int           //max idle connections kept per host
+	MaxConnsPerHost     int           //max connections per host including active ones, negative -> no limit
+	IdleConnTimeout     time.Duration //idle connection is closed after it
+	KeepAlive           time.Duration //TCP keep-alive period
+	DialTimeout         time.Duration //timeout to establish a TCP connection
+	TLSHandshakeTimeout time.Duration //timeout to perform TLS handshake
+	DisableHTTP2        bool          //don't try HTTP/2 for TLS connections
+	//refuse connections to non-public addresses (see Public), proxies from the environment are not used then,
+	//as only the address of the proxy could be checked
+	BlockPrivateNetworks bool
+	AllowedNetworks      []*net.IPNet //networks, which are allowed despite BlockPrivateNetworks, e.g. trusted internal services
+}
+
+// DefaultConfig
+//returns transport settings, which are used for zero values of Config
+func DefaultConfig() Config {
+	return Config{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		MaxConnsPerHost:     32,
+		IdleConnTimeout:     90 * time.Second,
+		KeepAlive:           30 * time.Second,
+		DialTimeout:         5 * time.Second,
+		TLSHandshakeTimeout: 5 * time.Second,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	defaults := DefaultConfig()
+	if c.MaxIdleConns == 0 {
+		c.MaxIdleConns = defaults.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost == 0 {
+		c.MaxIdleConnsPerHost = defaults.MaxIdleConnsPerHost
+	}
+	if c.MaxConnsPerHost == 0 {
+		c.MaxConnsPerHost = defaults.MaxConnsPerHost
+	}
+	if c.MaxConnsPerHost < 0 {
+		c.MaxConnsPerHost = 0
+	}
+	if c.IdleConnTimeout == 0 {
+		c.IdleConnTimeout = defaults.IdleConnTimeout
+	}
+	if c.KeepAlive == 0 {
+		c.KeepAlive = defaults.KeepAlive
+	}
+	if c.DialTimeout == 0 {
+		c.DialTimeout = defaults.DialTimeout
+	}
+	if c.TLSHandshakeTimeout == 0 {
+		c.TLSHandshakeTimeout = defaults.TLSHandshakeTimeout
+	}
+	return c
+}
+
+// Stats
+//connection pool statistics
+type Stats struct {
+	Requests    uint64           //requests sent
+	Dials       uint64           //new connections established
+	ReusedConns uint64           //requests sent over pooled connections
+	OpenConns   int64            //currently open connections
+	OpenByHost  map[string]int64 //currently open connections per host:port
+}
+
+// Transport
+//http.RoundTripper, which keeps a connection pool shared by all fetches and collects its statistics
+type Transport struct {
+	transport   *http.Transport
+	requests    uint64
+	dials       uint64
+	reusedConns uint64
+	openConns   int64
+	mu          sync.Mutex
+	openByHost  map[string]int64
+}
+
+func New(cfg Config) *Transport {
+	cfg = cfg.withDefaults()
+	t := &Transport{
+		openByHost: map[string]int64{},
+	}
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+	proxy := http.ProxyFromEnvironment
+	if cfg.BlockPrivateNetworks {
+		dialer.Control = (&guard{allowed: cfg.AllowedNetworks}).control
+		proxy = nil
+	}
+	t.transport = &http.Transport{
+		Proxy: proxy,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return t.track(conn, address), nil
+		},
+		ForceAttemptHTTP2:   !cfg.DisableHTTP2,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		TLSHandshakeTimeout: cfg.TLSHandshakeTimeout,
+	}
+	return t
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddUint64(&t.requests, 1)
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddUint64(&t.reusedConns, 1)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return t.transport.RoundTrip(req)
+}
+
+// CloseIdleConnections
+//closes pooled connections, which are not in use
+func (t *Transport) CloseIdleConnections() {
+	t.transport.CloseIdleConnections()
+}
+
+// Stats
+//returns a snapshot of the connection pool statistics
+func (t *Transport) Stats() Stats {
+	t.mu.Lock()
+	openByHost := make(map[string]int64, len(t.openByHost))
+	for host, count := range t.openByHost {
+		openByHost[host] = count
+	}
+	t.mu.Unlock()
+	return Stats{
+		Requests:    atomic.LoadUint64(&t.requests),
+		Dials:       atomic.LoadUint64(&t.dials),
+		ReusedConns: atomic.LoadUint64(&t.reusedConns),
+		OpenConns:   atomic.LoadInt64(&t.openConns),
+		OpenByHost:  openByHost,
+	}
+}
+
+//counts the new connection as open until it's closed
+func (t *Transport) track(conn net.Conn, address string) net.Conn {
+	atomic.AddUint64(&t.dials, 1)
+	atomic.AddInt64(&t.openConns, 1)
+	t.mu.Lock()
+	t.openByHost[address]++
+	t.mu.Unlock()
+	return &trackedConn{Conn: conn, release: func() {
+		atomic.AddInt64(&t.openConns, -1)
+		t.mu.Lock()
+		t.openByHost[address]--
+		if t.openByHost[address] <= 0 {
+			delete(t.openByHost, address)
+		}
+		t.mu.Unlock()
+	}}
+}
+
+type trackedConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
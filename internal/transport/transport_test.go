@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransport_Stats(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer testServer.Close()
+	host := strings.TrimPrefix(testServer.URL, "http://")
+
+	tests := []struct {
+		name       string
+		cfg        Config
+		concurrent int
+		wantDials  uint64
+	}{
+		{
+			name:       "sequential requests reuse the connection",
+			cfg:        Config{},
+			concurrent: 1,
+			wantDials:  1,
+		},
+		{
+			name:       "concurrent requests are limited per host",
+			cfg:        Config{MaxConnsPerHost: 1},
+			concurrent: 3,
+			wantDials:  1,
+		},
+		{
+			name:       "concurrent requests open connections",
+			cfg:        Config{MaxConnsPerHost: -1},
+			concurrent: 3,
+			wantDials:  3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := New(tt.cfg)
+			client := http.Client{Transport: tr}
+			get := func() {
+				resp, err := client.Get(testServer.URL)
+				if assert.NoError(t, err, "unexpected error") {
+					_, _ = io.Copy(io.Discard, resp.Body)
+					_ = resp.Body.Close()
+				}
+			}
+			//the first round opens connections, the second one reuses them
+			for round := 0; round < 2; round++ {
+				var wg sync.WaitGroup
+				for i := 0; i < tt.concurrent; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						get()
+					}()
+				}
+				wg.Wait()
+			}
+
+			stats := tr.Stats()
+			assert.Equal(t, uint64(2*tt.concurrent), stats.Requests, "requests")
+			assert.Equal(t, tt.wantDials, stats.Dials, "dials")
+			assert.Equal(t, stats.Requests-stats.Dials, stats.ReusedConns, "reused connections")
+			assert.Equal(t, map[string]int64{host: int64(tt.wantDials)}, stats.OpenByHost, "open connections by host")
+
+			tr.CloseIdleConnections()
+			stats = tr.Stats()
+			assert.Equal(t, int64(0), stats.OpenConns, "open connections after close")
+			assert.Empty(t, stats.OpenByHost, "open connections by host after close")
+		})
+	}
+}
@@ -1,24 +1,310 @@
+/*
+	The package implements a structured leveled logger, which writes JSON or logfmt records to stdout and/or
+	a rotated file.
+*/
 package logging
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
 )
 
-// init
-// spread logs between stdout and file
-func Init() {
-	err := os.MkdirAll("logs", 0755)
+// Level
+//severity of a record, records below the logger level are dropped
+type Level int32
 
-	if err != nil || os.IsExist(err) {
-		panic("can't create log dir. no configured logging to files")
-	} else {
-		allFile, err := os.OpenFile("logs/all.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel
+//parses a level name: debug, info, warn or error
+func ParseLevel(name string) (Level, error) {
+	for i, known := range levelNames {
+		if strings.EqualFold(name, known) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, must be one of %v", name, levelNames)
+}
+
+// Format
+//encoding of records
+type Format string
+
+const (
+	FormatLogfmt Format = "logfmt" //key=value pairs
+	FormatJSON   Format = "json"   //JSON object per line
+)
+
+// ParseFormat
+//checks the format name
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case FormatLogfmt, FormatJSON:
+		return Format(name), nil
+	}
+	return FormatLogfmt, fmt.Errorf("unknown log format %q, must be %s or %s", name, FormatLogfmt, FormatJSON)
+}
+
+// Config
+//logger settings, at least one of File and Stdout must be set
+type Config struct {
+	Level    Level
+	Format   Format
+	File     string   //file to write logs to, no file if empty
+	Stdout   bool     //write logs to stdout
+	Rotation Rotation //rotation of File
+}
+
+//destination of records, shared by a logger and all loggers derived from it
+type sink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format Format
+	level  int32 //Level, changed concurrently by SetLevel
+	closer io.Closer
+	now    func() time.Time
+}
+
+// Logger
+//writes records with a message and key-value fields, safe for concurrent use
+type Logger struct {
+	sink   *sink
+	fields []interface{} //key-value pairs added to every record
+}
+
+// New
+//creates a logger, which writes records to w
+func New(w io.Writer, format Format, level Level) *Logger {
+	return &Logger{sink: &sink{w: w, format: format, level: int32(level), now: time.Now}}
+}
+
+// Discard
+//creates a logger, which drops all records
+func Discard() *Logger {
+	return New(io.Discard, FormatLogfmt, LevelError)
+}
+
+// Open
+//creates a logger, which writes records to stdout and/or the rotated file, Close releases the file
+func Open(cfg Config) (*Logger, error) {
+	var writers []io.Writer
+	var closer io.Closer
+	if cfg.File != "" {
+		file, err := OpenRotatingFile(cfg.File, cfg.Rotation)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, file)
+		closer = file
+	}
+	if cfg.Stdout {
+		writers = append(writers, os.Stdout)
+	}
+	if len(writers) == 0 {
+		return nil, fmt.Errorf("no log outputs, set a file or stdout")
+	}
+	format := cfg.Format
+	if format == "" {
+		format = FormatLogfmt
+	}
+	logger := New(io.MultiWriter(writers...), format, cfg.Level)
+	logger.sink.closer = closer
+	return logger, nil
+}
+
+// Close
+//closes the log file, if any
+func (l *Logger) Close() error {
+	if l.sink.closer == nil {
+		return nil
+	}
+	return l.sink.closer.Close()
+}
+
+// With
+//returns a logger, which adds the key-value pairs to every record, the level is shared with l
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	return &Logger{sink: l.sink, fields: fields}
+}
+
+// SetLevel
+//changes the level of l and all loggers derived from it or sharing its parent
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.sink.level, int32(level))
+}
+
+func (l *Logger) Level() Level {
+	return Level(atomic.LoadInt32(&l.sink.level))
+}
+
+// Enabled
+//tells whether records of the level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+// StdLogger
+//returns a standard library logger, which writes every line as a record of the level,
+//e.g. for http.Server.ErrorLog
+func (l *Logger) StdLogger(level Level) *log.Logger {
+	return log.New(lineWriter{logger: l, level: level}, "", 0)
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	var buf bytes.Buffer
+	enc := encoder{buf: &buf, json: l.sink.format == FormatJSON}
+	enc.begin()
+	enc.field("time", l.sink.now().Format("2006-01-02T15:04:05.000Z07:00"))
+	enc.field("level", level.String())
+	enc.field("msg", msg)
+	enc.fields(l.fields)
+	enc.fields(keyvals)
+	enc.end()
+
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	_, _ = l.sink.w.Write(buf.Bytes())
+}
+
+//adapts Logger to io.Writer for the standard library logger
+type lineWriter struct {
+	logger *Logger
+	level  Level
+}
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w.logger.log(w.level, strings.TrimRight(string(p), "\n"), nil)
+	return len(p), nil
+}
+
+//encodes a single record
+type encoder struct {
+	buf   *bytes.Buffer
+	json  bool
+	count int
+}
+
+func (e *encoder) begin() {
+	if e.json {
+		e.buf.WriteByte('{')
+	}
+}
+
+func (e *encoder) end() {
+	if e.json {
+		e.buf.WriteByte('}')
+	}
+	e.buf.WriteByte('\n')
+}
+
+//encodes key-value pairs, a key without a value gets "(MISSING)"
+func (e *encoder) fields(keyvals []interface{}) {
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		e.field(key, value)
+	}
+}
+
+func (e *encoder) field(key string, value interface{}) {
+	value = plainValue(value)
+	if e.count > 0 {
+		if e.json {
+			e.buf.WriteByte(',')
+		} else {
+			e.buf.WriteByte(' ')
+		}
+	}
+	e.count++
+	if e.json {
+		keyData, _ := json.Marshal(key)
+		e.buf.Write(keyData)
+		e.buf.WriteByte(':')
+		data, err := json.Marshal(value)
 		if err != nil {
-			log.Fatalf("Failed to set-up logging system : %s", err.Error())
+			data, _ = json.Marshal(fmt.Sprint(value))
 		}
-		log.SetOutput(io.MultiWriter(allFile, os.Stdout))
+		e.buf.Write(data)
+		return
+	}
+	e.buf.WriteString(key)
+	e.buf.WriteByte('=')
+	e.buf.WriteString(logfmtValue(fmt.Sprint(value)))
+}
+
+//converts values, which are not readable as JSON, to strings
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case time.Duration:
+		return v.String()
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
 	}
+	return value
+}
 
+//quotes the value if it's empty or has spaces, quotes, '=' or control characters
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	for _, r := range value {
+		if r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return strconv.Quote(value)
+		}
+	}
+	return value
 }
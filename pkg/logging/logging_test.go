@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2022, 5, 1, 10, 20, 30, 0, time.UTC)
+
+func TestLogger(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		format Format
+		level  Level
+		log    func(l *Logger)
+		want   string
+	}{
+		{
+			name:   "logfmt",
+			format: FormatLogfmt,
+			level:  LevelInfo,
+			log: func(l *Logger) {
+				l.With("rid", "abc").Info("Fetch finished", "duration", 1500*time.Millisecond, "err", errors.New("a b"))
+			},
+			want: `time=2022-05-01T10:20:30.000Z level=info msg="Fetch finished" rid=abc duration=1.5s err="a b"` + "\n",
+		},
+		{
+			name:   "json",
+			format: FormatJSON,
+			level:  LevelDebug,
+			log: func(l *Logger) {
+				l.Debug("Fetching", "url", "http://a", "status", 200, "odd")
+			},
+			want: `{"time":"2022-05-01T10:20:30.000Z","level":"debug","msg":"Fetching","url":"http://a","status":200,"odd":"(MISSING)"}` + "\n",
+		},
+		{
+			name:   "below level",
+			format: FormatJSON,
+			level:  LevelWarn,
+			log:    func(l *Logger) { l.Info("dropped") },
+			want:   "",
+		},
+		{
+			name:   "level changed by derived logger",
+			format: FormatLogfmt,
+			level:  LevelInfo,
+			log: func(l *Logger) {
+				l.With("a", 1).SetLevel(LevelError)
+				l.Warn("dropped")
+				l.StdLogger(LevelError).Printf("server error")
+			},
+			want: `time=2022-05-01T10:20:30.000Z level=error msg="server error"` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := New(&buf, tt.format, tt.level)
+			l.sink.now = func() time.Time { return testTime }
+			tt.log(l)
+			assert.Equal(t, tt.want, buf.String(), "records don't match")
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+
+	level, err := ParseLevel("WARN")
+	assert.NoError(t, err, "failed to parse level")
+	assert.Equal(t, LevelWarn, level, "levels don't match")
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err, "expected an error")
+}
+
+func TestRotatingFile(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		rotation    Rotation
+		writes      int
+		elapsed     time.Duration //time passed between writes
+		wantBackups int
+	}{
+		{name: "no rotation", writes: 5},
+		{name: "by size", rotation: Rotation{MaxBytes: 25}, writes: 5, wantBackups: 2},
+		{name: "by size with max backups", rotation: Rotation{MaxBytes: 10, MaxBackups: 2}, writes: 5, wantBackups: 2},
+		{name: "by age", rotation: Rotation{MaxAge: time.Hour}, writes: 3, elapsed: time.Hour, wantBackups: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "logs", "all.log")
+			f, err := OpenRotatingFile(path, tt.rotation)
+			assert.NoError(t, err, "failed to open file")
+			now := testTime
+			f.now = func() time.Time { return now }
+			f.opened = now
+
+			for i := 0; i < tt.writes; i++ {
+				_, err = f.Write([]byte("0123456789"))
+				assert.NoError(t, err, "failed to write")
+				now = now.Add(tt.elapsed + time.Millisecond)
+			}
+			assert.NoError(t, f.Close(), "failed to close")
+
+			backups, _ := filepath.Glob(path + ".*")
+			assert.Equal(t, tt.wantBackups, len(backups), "backups count doesn't match")
+			data, err := os.ReadFile(path)
+			assert.NoError(t, err, "failed to read file")
+			assert.NotEmpty(t, data, "current file is empty")
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+//suffix of rotated files, sorts in chronological order
+const backupTimeFormat = "20060102T150405.000"
+
+// Rotation
+//rotation settings of a log file, zero values disable the corresponding rule
+type Rotation struct {
+	MaxBytes   int64         //the file is rotated before it exceeds the size
+	MaxAge     time.Duration //the file is rotated after being written for this long since it was opened
+	MaxBackups int           //max rotated files to keep, older ones are removed, 0 -> keep all
+}
+
+// RotatingFile
+//log file, which is renamed to "<path>.<time>" and replaced by a new one according to Rotation
+type RotatingFile struct {
+	path     string
+	rotation Rotation
+	mu       sync.Mutex
+	file     *os.File
+	size     int64     //bytes written to file
+	opened   time.Time //when file was opened
+	now      func() time.Time
+}
+
+// OpenRotatingFile
+//opens the file for appending, its directory is created if missing
+func OpenRotatingFile(path string, rotation Rotation) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("can't create log dir: %w", err)
+	}
+	f := &RotatingFile{path: path, rotation: rotation, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("can't open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("can't open log file: %w", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = f.now()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.due(int64(len(p))) {
+		//the current file is kept on failure, logs are better in the wrong file than nowhere
+		_ = f.rotate()
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+//tells whether the file must be rotated before writing n bytes, an empty file is never rotated
+func (f *RotatingFile) due(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.rotation.MaxBytes > 0 && f.size+n > f.rotation.MaxBytes {
+		return true
+	}
+	return f.rotation.MaxAge > 0 && f.now().Sub(f.opened) >= f.rotation.MaxAge
+}
+
+func (f *RotatingFile) rotate() error {
+	backup := f.path + "." + f.now().Format(backupTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	old := f.file
+	if err := f.open(); err != nil {
+		//writes still go to the renamed file
+		return err
+	}
+	_ = old.Close()
+	return f.removeBackups()
+}
+
+//removes the oldest rotated files over MaxBackups
+func (f *RotatingFile) removeBackups() error {
+	if f.rotation.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return err
+	}
+	var rotated []string
+	for _, backup := range backups {
+		if _, err := time.Parse(backupTimeFormat, backup[len(f.path)+1:]); err == nil {
+			rotated = append(rotated, backup)
+		}
+	}
+	sort.Strings(rotated)
+	for len(rotated) > f.rotation.MaxBackups {
+		if err := os.Remove(rotated[0]); err != nil {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
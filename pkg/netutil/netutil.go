@@ -11,6 +11,7 @@ package netutil
 import (
 	"net"
 	"sync"
+	"sync/atomic"
 )
 
 // LimitListener returns a Listener that accepts at most n simultaneous
@@ -23,8 +24,26 @@ func LimitListener(l net.Listener, n int) net.Listener {
 	}
 }
 
+// LimitStats
+//occupancy of a listener returned by LimitListener
+type LimitStats struct {
+	Active int //accepted connections, which are not closed yet
+	Limit  int //max simultaneous connections
+}
+
+// Stats
+//returns occupancy of the listener, ok is false if it's not returned by LimitListener
+func Stats(l net.Listener) (stats LimitStats, ok bool) {
+	limited, ok := l.(*limitListener)
+	if !ok {
+		return LimitStats{}, false
+	}
+	return LimitStats{Active: int(atomic.LoadInt64(&limited.active)), Limit: cap(limited.sem)}, true
+}
+
 type limitListener struct {
 	net.Listener
+	active    int64 //accepted connections, which are not closed yet
 	sem       chan struct{}
 	closeOnce sync.Once     // ensures the done chan is only closed once
 	done      chan struct{} // no values sent; closed when Close is called
@@ -43,6 +62,11 @@ func (l *limitListener) acquire() bool {
 }
 func (l *limitListener) release() { <-l.sem }
 
+func (l *limitListener) releaseConn() {
+	atomic.AddInt64(&l.active, -1)
+	l.release()
+}
+
 func (l *limitListener) Accept() (net.Conn, error) {
 	if !l.acquire() {
 		// If the semaphore isn't acquired because the listener was closed, expect
@@ -67,7 +91,8 @@ func (l *limitListener) Accept() (net.Conn, error) {
 		l.release()
 		return nil, err
 	}
-	return &limitListenerConn{Conn: c, release: l.release}, nil
+	atomic.AddInt64(&l.active, 1)
+	return &limitListenerConn{Conn: c, release: l.releaseConn}, nil
 }
 
 func (l *limitListener) Close() error {
@@ -0,0 +1,90 @@
+/*
+	The package implements normalization of urls, so equivalent urls are written the same way.
+*/
+package urlutil
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//ports, which are omitted in normalized urls
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// Normalize
+//validates the absolute url and returns its normalized form: scheme and host are lower-cased,
+//internationalized host is encoded with Punycode, the default port of the scheme and the fragment are removed.
+//The error tells why the url is invalid
+func Normalize(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return "", urlErr.Err
+		}
+		return "", err
+	}
+	if u.Scheme == "" {
+		return "", errors.New("missing scheme")
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", errors.New("missing host")
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if host == "" {
+		return "", errors.New("missing host")
+	}
+	if strings.Contains(host, ":") {
+		//IPv6 literal, zones are not allowed in urls to fetch
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return "", errors.New("invalid IPv6 address")
+		}
+		if ip.To4() != nil {
+			//IPv4-mapped address is printed in the dotted form, which can't be bracketed
+			host = ip.String()
+		} else {
+			host = "[" + ip.String() + "]"
+		}
+	} else {
+		host, err = HostToASCII(strings.ToLower(host))
+		if err != nil {
+			return "", err
+		}
+		if err = checkLabels(host); err != nil {
+			return "", err
+		}
+	}
+	if port != "" {
+		number, err := strconv.Atoi(port)
+		if err != nil || number < 1 || number > 65535 {
+			return "", errors.New("port out of range 1-65535")
+		}
+		port = strconv.Itoa(number)
+	}
+	if port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	u.Host = host
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String(), nil
+}
+
+//checks labels of the ASCII host name, the trailing dot of a fully qualified name is allowed
+func checkLabels(host string) error {
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+	for _, label := range labels {
+		if label == "" {
+			return errors.New("empty label in host")
+		}
+		if len(label) > 63 {
+			return errors.New("host label is longer than 63 characters")
+		}
+	}
+	return nil
+}
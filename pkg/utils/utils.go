@@ -1,27 +1,54 @@
 package utils
 
-import "fmt"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
 
-// RemoveDuplicates
-//removes duplicates from original list and returns a new list of strings
-func RemoveDuplicates(input []string) []string {
-	if len(input) == 0 {
-		return input
-	}
-	table := map[string]struct{}{}
+// IndexDuplicates
+//removes duplicates from original list and returns a new list of strings,
+//also returns the index in the new list for every item of the original one
+func IndexDuplicates(input []string) ([]string, []int) {
+	table := make(map[string]int, len(input))
 	output := make([]string, 0, len(input))
+	positions := make([]int, len(input))
 
-	for _, item := range input {
-		if _, exists := table[item]; !exists {
-			table[item] = struct{}{}
+	for i, item := range input {
+		pos, exists := table[item]
+		if !exists {
+			pos = len(output)
+			table[item] = pos
 			output = append(output, item)
 		}
+		positions[i] = pos
+	}
+	return output, positions
+}
+
+// NewRequestId
+//returns a random request id of 32 hex digits
+func NewRequestId() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		//crypto/rand doesn't fail on supported platforms, fall back to the time anyway
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
 	}
-	return output
+	return hex.EncodeToString(id[:])
 }
 
-//WithRid
-//returns new string with request id
-func WithRid(input string, rid uint32) string {
-	return fmt.Sprintf("%s [rid=%X]", input, rid)
+// ValidRequestId
+//tells whether the request id, received from a client, is safe to log and forward:
+//1-128 printable ASCII characters without spaces
+func ValidRequestId(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
 }
@@ -2,53 +2,66 @@ package utils
 
 import (
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
-func TestRemoveDuplicates(t *testing.T) {
+func TestIndexDuplicates(t *testing.T) {
 
 	tests := []struct {
-		name  string
-		input []string
-		want  []string
+		name          string
+		input         []string
+		want          []string
+		wantPositions []int
 	}{
 		{
-			name:  "default",
-			input: []string{"a", "b", "a", "b", "c"},
-			want:  []string{"a", "b", "c"},
+			name:          "default",
+			input:         []string{"a", "b", "a", "b", "c"},
+			want:          []string{"a", "b", "c"},
+			wantPositions: []int{0, 1, 0, 1, 2},
 		},
 		{
-			name:  "empty",
-			input: []string{},
-			want:  []string{},
+			name:          "empty",
+			input:         []string{},
+			want:          []string{},
+			wantPositions: []int{},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.ElementsMatch(t, RemoveDuplicates(tt.input), tt.want, "Lists doesn't match")
+			output, positions := IndexDuplicates(tt.input)
+			assert.Equal(t, tt.want, output, "Lists doesn't match")
+			assert.Equal(t, tt.wantPositions, positions, "Positions doesn't match")
 		})
 	}
 }
 
-func TestWithRid(t *testing.T) {
+func TestNewRequestId(t *testing.T) {
+
+	first, second := NewRequestId(), NewRequestId()
+	assert.Len(t, first, 32, "unexpected length")
+	assert.NotEqual(t, first, second, "request ids are not unique")
+	assert.True(t, ValidRequestId(first), "generated request id is not valid")
+}
+
+func TestValidRequestId(t *testing.T) {
 
 	tests := []struct {
-		name  string
-		input string
-		rid   uint32
-		want  string
+		name string
+		id   string
+		want bool
 	}{
-		{
-			name:  "default",
-			input: "test",
-			rid:   0,
-			want:  "test [rid=0]",
-		},
+		{name: "uuid", id: "3f2b8c1e-7d4a-4b5e-9c6f-0a1b2c3d4e5f", want: true},
+		{name: "empty", id: "", want: false},
+		{name: "space", id: "a b", want: false},
+		{name: "line break", id: "a\nb", want: false},
+		{name: "non ascii", id: "идентификатор", want: false},
+		{name: "too long", id: strings.Repeat("a", 129), want: false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equal(t, tt.want, WithRid(tt.input, tt.rid), "strings don't match")
+			assert.Equal(t, tt.want, ValidRequestId(tt.id), "validity doesn't match")
 		})
 	}
 }
@@ -1,4 +1,4 @@
-curl -X POST http://localhost:10000 -H 'Content-Type: application/json' \
+curl -X POST http://localhost:10000/v1/fetch -H 'Content-Type: application/json' \
 -d '{
     "urls":[
         "http://ya.ru",